@@ -0,0 +1,204 @@
+// Package authtoken ออกและตรวจ JWT ของระบบ รองรับหลาย key เลือกด้วย header "kid"
+// เพื่อหมุนเปลี่ยน key ได้โดยไม่ทำให้ทุกคนหลุดจากระบบ
+package authtoken
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// kid ของ key จาก JWT_SECRET เดิม token เก่าที่ไม่มี kid จะตรวจด้วย key นี้
+const LegacyKeyID = "default"
+
+var (
+	ErrNoKeys         = errors.New("no JWT signing key configured (set JWT_SECRET, JWT_KEYS or JWT_KEY_FILES)")
+	ErrNotInitialized = errors.New("authtoken: keys not loaded")
+	ErrUnknownKey     = errors.New("authtoken: unknown key id")
+)
+
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // nil = ใช้ตรวจอย่างเดียว (เช่น public key ของ key เก่า)
+	VerifyKey interface{}
+}
+
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+var keys *KeySet
+
+// Init โหลด key จาก env ต้องเรียกตอนเริ่ม server ถ้าไม่มี key เลยจะคืน error
+func Init() error {
+	ks, err := LoadFromEnv()
+	if err != nil {
+		return err
+	}
+	keys = ks
+	return nil
+}
+
+// LoadFromEnv อ่าน key จาก
+//   - JWT_SECRET: HMAC key เดิม (kid "default")
+//   - JWT_KEYS: HMAC หลายตัว รูปแบบ "kid1:secret1,kid2:secret2"
+//   - JWT_KEY_FILES: ไฟล์ PEM รูปแบบ "kid=/path/key.pem,..." รองรับ RSA (RS256) และ Ed25519 (EdDSA)
+//     private key ใช้ได้ทั้งออกและตรวจ ส่วน public key ใช้ตรวจอย่างเดียว
+//   - JWT_ACTIVE_KID: kid ที่ใช้ออก token ใหม่ (ค่าเริ่มต้น = key แรกที่โหลดได้และเซ็นได้)
+func LoadFromEnv() (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*Key{}}
+	var order []string
+	add := func(k *Key) error {
+		if _, dup := ks.keys[k.ID]; dup {
+			return fmt.Errorf("duplicate JWT key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+		order = append(order, k.ID)
+		return nil
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		if err := add(hmacKey(LegacyKeyID, secret)); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range splitList(os.Getenv("JWT_KEYS")) {
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("JWT_KEYS: invalid entry %q, want kid:secret", entry)
+		}
+		if err := add(hmacKey(kid, secret)); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range splitList(os.Getenv("JWT_KEY_FILES")) {
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("JWT_KEY_FILES: invalid entry %q, want kid=/path/key.pem", entry)
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEY_FILES: %w", err)
+		}
+		key, err := pemKey(kid, pem)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEY_FILES %s: %w", kid, err)
+		}
+		if err := add(key); err != nil {
+			return nil, err
+		}
+	}
+	if len(ks.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	if kid := os.Getenv("JWT_ACTIVE_KID"); kid != "" {
+		ks.active = ks.keys[kid]
+		if ks.active == nil {
+			return nil, fmt.Errorf("JWT_ACTIVE_KID %q not found", kid)
+		}
+	} else {
+		for _, kid := range order {
+			if ks.keys[kid].SignKey != nil {
+				ks.active = ks.keys[kid]
+				break
+			}
+		}
+	}
+	if ks.active == nil || ks.active.SignKey == nil {
+		return nil, errors.New("active JWT key cannot sign (public key only)")
+	}
+	return ks, nil
+}
+
+func hmacKey(kid, secret string) *Key {
+	if len(secret) < 32 {
+		log.Printf("⚠️ JWT key %q is shorter than 32 bytes, consider a longer secret\n", kid)
+	}
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, SignKey: []byte(secret), VerifyKey: []byte(secret)}
+}
+
+func pemKey(kid string, pem []byte) (*Key, error) {
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, SignKey: private, VerifyKey: &private.PublicKey}, nil
+	}
+	if private, err := jwt.ParseEdPrivateKeyFromPEM(pem); err == nil {
+		edKey, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("unsupported Ed private key")
+		}
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, SignKey: edKey, VerifyKey: edKey.Public()}, nil
+	}
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, VerifyKey: public}, nil
+	}
+	if public, err := jwt.ParseEdPublicKeyFromPEM(pem); err == nil {
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, VerifyKey: public}, nil
+	}
+	return nil, errors.New("unsupported key, want RSA or Ed25519 PEM")
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Sign ออก token ด้วย key ที่ใช้งานอยู่ ใส่ kid ใน header
+func Sign(claims jwt.MapClaims) (string, error) {
+	if keys == nil {
+		return "", ErrNotInitialized
+	}
+	return keys.Sign(claims)
+}
+
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.SignKey)
+}
+
+// Parse ตรวจลายเซ็นและวันหมดอายุ เลือก key ตาม kid (ไม่มี kid = key เดิมจาก JWT_SECRET)
+func Parse(tokenString string) (jwt.MapClaims, error) {
+	if keys == nil {
+		return nil, ErrNotInitialized
+	}
+	return keys.Parse(tokenString)
+}
+
+func (ks *KeySet) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = LegacyKeyID
+		}
+		key := ks.keys[kid]
+		if key == nil {
+			return nil, ErrUnknownKey
+		}
+		// กันการสลับ algorithm (เช่น เอา public key ไปใช้เป็น HMAC secret)
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return claims, nil
+}
@@ -0,0 +1,273 @@
+package authtoken
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testSecretA = "secret-a-0123456789abcdef0123456789"
+	testSecretB = "secret-b-0123456789abcdef0123456789"
+)
+
+func clearKeyEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"JWT_SECRET", "JWT_KEYS", "JWT_KEY_FILES", "JWT_ACTIVE_KID"} {
+		t.Setenv(name, "")
+	}
+}
+
+// เขียน PEM ลงไฟล์ชั่วคราว คืน path
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func rsaKeyFiles(t *testing.T) (private, public string, key *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		writePEM(t, "rsa.pub.pem", "PUBLIC KEY", publicDER), key
+}
+
+func edKeyFile(t *testing.T) string {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "ed.pem", "PRIVATE KEY", der)
+}
+
+func loadKeys(t *testing.T, env map[string]string) *KeySet {
+	t.Helper()
+	clearKeyEnv(t)
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	ks, err := LoadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func headerOf(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Header
+}
+
+func TestLoadFromEnvActiveKey(t *testing.T) {
+	rsaPrivate, rsaPublic, _ := rsaKeyFiles(t)
+	edPrivate := edKeyFile(t)
+
+	for _, tc := range []struct {
+		name       string
+		env        map[string]string
+		wantActive string
+		wantAlg    string
+	}{
+		{"legacy secret", map[string]string{"JWT_SECRET": testSecretA}, LegacyKeyID, "HS256"},
+		{"first loaded key", map[string]string{"JWT_KEYS": "k1:" + testSecretA + ",k2:" + testSecretB}, "k1", "HS256"},
+		{"explicit active kid", map[string]string{"JWT_SECRET": testSecretA, "JWT_KEYS": "k2:" + testSecretB, "JWT_ACTIVE_KID": "k2"}, "k2", "HS256"},
+		{"rsa private key", map[string]string{"JWT_KEY_FILES": "rsa1=" + rsaPrivate}, "rsa1", "RS256"},
+		{"ed25519 private key", map[string]string{"JWT_KEY_FILES": "ed1=" + edPrivate}, "ed1", "EdDSA"},
+		{"skip public-only key", map[string]string{"JWT_KEY_FILES": "old=" + rsaPublic + ",new=" + edPrivate}, "new", "EdDSA"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ks := loadKeys(t, tc.env)
+			token, err := ks.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := headerOf(t, token)
+			if header["kid"] != tc.wantActive || header["alg"] != tc.wantAlg {
+				t.Fatalf("header = %v, want kid %s alg %s", header, tc.wantActive, tc.wantAlg)
+			}
+			if _, err := ks.Parse(token); err != nil {
+				t.Fatalf("Parse own token: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnvRejectsInvalid(t *testing.T) {
+	_, rsaPublic, _ := rsaKeyFiles(t)
+	junk := writePEM(t, "junk.pem", "PRIVATE KEY", []byte("not a key"))
+
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"no keys", map[string]string{}, "no JWT signing key"},
+		{"bad JWT_KEYS entry", map[string]string{"JWT_KEYS": "k1"}, "invalid entry"},
+		{"empty secret", map[string]string{"JWT_KEYS": "k1:"}, "invalid entry"},
+		{"duplicate kid", map[string]string{"JWT_SECRET": testSecretA, "JWT_KEYS": LegacyKeyID + ":" + testSecretB}, "duplicate"},
+		{"unknown active kid", map[string]string{"JWT_SECRET": testSecretA, "JWT_ACTIVE_KID": "missing"}, "not found"},
+		{"active key is public only", map[string]string{"JWT_KEY_FILES": "pub=" + rsaPublic}, "cannot sign"},
+		{"explicit public active key", map[string]string{"JWT_SECRET": testSecretA, "JWT_KEY_FILES": "pub=" + rsaPublic, "JWT_ACTIVE_KID": "pub"}, "cannot sign"},
+		{"missing key file", map[string]string{"JWT_KEY_FILES": "k1=/nonexistent/key.pem"}, "JWT_KEY_FILES"},
+		{"unsupported key file", map[string]string{"JWT_KEY_FILES": "k1=" + junk}, "unsupported key"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearKeyEnv(t)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			_, err := LoadFromEnv()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("LoadFromEnv error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// หมุน key: token ที่ออกด้วย key เก่ายังใช้ได้ตราบที่ key เก่ายังอยู่ในชุด
+func TestParseSelectsKeyByKid(t *testing.T) {
+	before := loadKeys(t, map[string]string{"JWT_KEYS": "k1:" + testSecretA})
+	oldToken, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := loadKeys(t, map[string]string{"JWT_KEYS": "k1:" + testSecretA + ",k2:" + testSecretB, "JWT_ACTIVE_KID": "k2"})
+	newToken, err := rotated.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := headerOf(t, newToken)["kid"]; kid != "k2" {
+		t.Fatalf("new token kid = %v, want k2", kid)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := rotated.Parse(token); err != nil {
+			t.Errorf("%s token rejected after rotation: %v", name, err)
+		}
+	}
+
+	retired := loadKeys(t, map[string]string{"JWT_KEYS": "k2:" + testSecretB})
+	if _, err := retired.Parse(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of retired key: error = %v, want ErrUnknownKey", err)
+	}
+}
+
+// token เก่าที่ไม่มี kid ตรวจด้วย key จาก JWT_SECRET
+func TestParseLegacyTokenWithoutKid(t *testing.T) {
+	ks := loadKeys(t, map[string]string{"JWT_SECRET": testSecretA, "JWT_KEYS": "k2:" + testSecretB, "JWT_ACTIVE_KID": "k2"})
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte(testSecretA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(legacy); err != nil {
+		t.Fatalf("legacy token rejected: %v", err)
+	}
+
+	// ไม่มี kid แต่เซ็นด้วย key อื่นต้องไม่ผ่าน
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte(testSecretB))
+	if _, err := ks.Parse(forged); err == nil {
+		t.Fatal("token without kid signed by a non-legacy key was accepted")
+	}
+}
+
+func TestParseRejectsForgedTokens(t *testing.T) {
+	rsaPrivate, _, rsaKey := rsaKeyFiles(t)
+	ks := loadKeys(t, map[string]string{"JWT_KEYS": "k1:" + testSecretA, "JWT_KEY_FILES": "rsa1=" + rsaPrivate, "JWT_ACTIVE_KID": "rsa1"})
+
+	publicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	for name, token := range map[string]string{
+		// เอา public key ของ RSA มาใช้เป็น HMAC secret (alg confusion)
+		"hs256 with rsa public key": sign(jwt.SigningMethodHS256, "rsa1", publicPEM),
+		"hs256 with rsa public der": sign(jwt.SigningMethodHS256, "rsa1", publicDER),
+		// alg ไม่ตรงกับ key ของ kid แม้จะเซ็นด้วย secret ที่ถูก
+		"hs384 for hs256 key": sign(jwt.SigningMethodHS384, "k1", []byte(testSecretA)),
+		"alg none":            sign(jwt.SigningMethodNone, "k1", jwt.UnsafeAllowNoneSignatureType),
+		"wrong secret":        sign(jwt.SigningMethodHS256, "k1", []byte(testSecretB)),
+		"unknown kid":         sign(jwt.SigningMethodHS256, "k9", []byte(testSecretA)),
+		"tampered payload":    tamper(sign(jwt.SigningMethodRS256, "rsa1", rsaKey)),
+	} {
+		if _, err := ks.Parse(token); err == nil {
+			t.Errorf("%s: forged token accepted", name)
+		}
+	}
+}
+
+// แก้ payload แต่คงลายเซ็นเดิม
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	payload := fmt.Sprintf(`{"user_id":"admin","exp":%d}`, time.Now().Add(time.Hour).Unix())
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + parts[2]
+}
+
+func TestParseRejectsExpired(t *testing.T) {
+	ks := loadKeys(t, map[string]string{"JWT_SECRET": testSecretA})
+	token, err := ks.Sign(jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(token); err == nil {
+		t.Fatal("expired token accepted")
+	}
+}
+
+func TestPackageFunctionsRequireInit(t *testing.T) {
+	previous := keys
+	keys = nil
+	t.Cleanup(func() { keys = previous })
+
+	if _, err := Sign(testClaims()); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Sign error = %v, want ErrNotInitialized", err)
+	}
+	if _, err := Parse("a.b.c"); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Parse error = %v, want ErrNotInitialized", err)
+	}
+}
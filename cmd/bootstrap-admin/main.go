@@ -0,0 +1,92 @@
+// bootstrap-admin ตั้งผู้ดูแลระบบคนแรก ใช้ครั้งเดียวตอนติดตั้ง หลังจากนั้นให้ admin จัดการบทบาทผ่าน /api/admin/users/:id/roles
+//
+//	go run ./cmd/bootstrap-admin -gmail admin@example.com
+//	go run ./cmd/bootstrap-admin -gmail admin@example.com -username admin -phone 0800000000 -password secret
+package main
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func main() {
+	gmail := flag.String("gmail", "", "อีเมลของผู้ใช้ที่จะเป็น admin (จำเป็น)")
+	username := flag.String("username", "", "ชื่อผู้ใช้ ถ้าต้องสร้างบัญชีใหม่")
+	phone := flag.String("phone", "", "เบอร์โทร ถ้าต้องสร้างบัญชีใหม่")
+	password := flag.String("password", "", "รหัสผ่าน ถ้าต้องสร้างบัญชีใหม่")
+	force := flag.Bool("force", false, "ตั้ง admin เพิ่มแม้จะมี admin อยู่แล้ว")
+	flag.Parse()
+
+	if *gmail == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if _, err := os.Stat(".env"); err == nil {
+		_ = godotenv.Load()
+	}
+	db.InitDB()
+	defer db.DisconnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := models.BackfillUserRoles(ctx); err != nil {
+		log.Fatalf("❌ Failed to backfill roles: %v", err)
+	}
+
+	admins, err := models.CountUsersWithRole(ctx, models.RoleAdmin)
+	if err != nil {
+		log.Fatalf("❌ Failed to count admins: %v", err)
+	}
+	if admins > 0 && !*force {
+		log.Fatalf("❌ มี admin อยู่แล้ว %d คน ใช้ -force ถ้าต้องการเพิ่มจริง ๆ", admins)
+	}
+
+	users := db.OpenCollection("users")
+	var user models.User
+	err = users.FindOne(ctx, bson.M{"gmail": *gmail}).Decode(&user)
+	switch {
+	case err == nil:
+		if err := models.GrantRole(ctx, user.ID, models.RoleAdmin); err != nil {
+			log.Fatalf("❌ Failed to grant admin: %v", err)
+		}
+		log.Printf("✅ %s is now an admin\n", *gmail)
+
+	case err == mongo.ErrNoDocuments:
+		if *username == "" || *phone == "" || *password == "" {
+			log.Fatalf("❌ ไม่พบผู้ใช้ %s ต้องระบุ -username -phone -password เพื่อสร้างบัญชีใหม่", *gmail)
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(*password), 14)
+		if err != nil {
+			log.Fatalf("❌ Failed to hash password: %v", err)
+		}
+		user = models.User{
+			ID:          primitive.NewObjectID(),
+			Username:    *username,
+			Gmail:       *gmail,
+			Phonenumber: *phone,
+			Password:    string(hashed),
+			LikedItems:  []string{},
+			Roles:       []string{models.RoleBuyer, models.RoleAdmin},
+		}
+		if _, err := users.InsertOne(ctx, user); err != nil {
+			log.Fatalf("❌ Failed to create admin: %v", err)
+		}
+		log.Printf("✅ Created admin %s (%s)\n", *gmail, user.ID.Hex())
+
+	default:
+		log.Fatalf("❌ Failed to find user: %v", err)
+	}
+}
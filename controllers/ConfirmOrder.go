@@ -5,12 +5,10 @@ import (
 	"arttoy-hub/models"
 	"context"
 	"github.com/gin-gonic/gin"
-	"github.com/omise/omise-go"
-	"github.com/omise/omise-go/operations"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -31,7 +29,7 @@ func ConfirmOrderDelivery(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
 	var order models.Order
@@ -47,9 +45,9 @@ func ConfirmOrderDelivery(c *gin.Context) {
 		return
 	}
 
-	//  ตรวจว่าคำสั่งซื้อต้องอยู่ในสถานะ "paid"
-	if order.Status != "processing" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order not in paid state"})
+	//  ตรวจว่าคำสั่งซื้อต้องอยู่ในสถานะ "processing" (ผู้ขายส่งของแล้ว)
+	if !models.CanTransition(order.Status, models.OrderCompleted) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only 'processing' orders can be confirmed"})
 		return
 	}
 
@@ -59,64 +57,29 @@ func ConfirmOrderDelivery(c *gin.Context) {
 		return
 	}
 
-	//  ดึงสินค้าแรก (สินค้ามือสองมีชิ้นเดียว)
 	if len(order.Items) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Order has no items"})
 		return
 	}
 
-	var product models.Product
-	err = db.OpenCollection("products").FindOne(ctx, bson.M{"_id": order.Items[0].ProductID}).Decode(&product)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Product not found"})
-		return
-	}
-
-	// ดึงข้อมูลผู้ขายจาก product
-	var seller models.User
-	err = db.OpenCollection("users").FindOne(ctx, bson.M{"_id": product.SellerID}).Decode(&seller)
-	if err != nil || seller.SellerInfo == nil || seller.SellerInfo.RecipientID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Seller or recipient not found"})
-		return
-	}
-
-	// สร้าง Omise client
-	client, err := omise.NewClient(
-		os.Getenv("OMISE_PUBLIC_KEY"),
-		os.Getenv("OMISE_SECRET_KEY"),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Omise client error"})
-		return
-	}
-
-	// สร้าง transfer ไปยัง recipient ของผู้ขาย
-	transfer := &omise.Transfer{}
-	err = client.Do(transfer, &operations.CreateTransfer{
-		Amount:    int64(order.Total * 100), // แปลงเป็นสตางค์
-		Recipient: seller.SellerInfo.RecipientID,
+	// อัปเดตสถานะ order เป็น completed พร้อมย้ายเงินจาก escrow เข้า wallet ของผู้ขายแต่ละคน
+	_, err = models.CompleteOrder(ctx, objID, order.Status, models.OrderEvent{
+		Actor:   models.ActorBuyer,
+		ActorID: userObjID,
+		Reason:  "buyer confirmed delivery",
 	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transfer failed", "details": err.Error()})
+	if err == models.ErrOrderStatusStale {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status has changed, please refresh"})
 		return
 	}
-
-	// อัปเดตสถานะ order เป็น completed และเก็บ transfer_id
-	_, err = db.OpenCollection("orders").UpdateByID(ctx, objID, bson.M{
-		"$set": bson.M{
-			"status":      "completed",
-			"transfer_id": transfer.ID,
-		},
-	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		log.Printf("❌ Failed to complete and settle order %s: %v\n", objID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete order"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "Transfer completed successfully",
-		"transfer_id": transfer.ID,
-	})
+	// เงินจะถูกโอนออกให้ผู้ขายในรอบโอนเงินตามกำหนด (RunSellerPayouts)
+	c.JSON(http.StatusOK, gin.H{"message": "Order completed successfully"})
 }
 
 
@@ -172,26 +135,37 @@ func UpdateTrackingNumber(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Order has no items"})
 		return
 	}
-	var product models.Product
-	err = db.OpenCollection("products").FindOne(ctx, bson.M{"_id": order.Items[0].ProductID}).Decode(&product)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Product not found"})
-		return
-	}
-
-	if product.SellerID != userObjID {
+	if !order.BelongsToSeller(userObjID) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to update this order"})
 		return
 	}
 
 	// ✅ อัปเดต tracking + sender + status
-	_, err = db.OpenCollection("orders").UpdateByID(ctx, objID, bson.M{
-		"$set": bson.M{
-			"tracking_number": input.TrackingNumber,
-			"sender_name":     input.SenderName,
-			"status":          "processing",
-		},
-	})
+	tracking := bson.M{
+		"tracking_number": input.TrackingNumber,
+		"sender_name":     input.SenderName,
+	}
+	switch order.Status {
+	case models.OrderProcessing:
+		// แก้เลขพัสดุที่กรอกไปแล้ว สถานะไม่เปลี่ยน
+		_, err = db.OpenCollection("orders").UpdateOne(ctx,
+			bson.M{"_id": objID, "status": models.OrderProcessing},
+			bson.M{"$set": tracking},
+		)
+	case models.OrderShipping:
+		_, err = models.TransitionOrder(ctx, objID, order.Status, models.OrderProcessing, models.OrderEvent{
+			Actor:   models.ActorSeller,
+			ActorID: userObjID,
+			Reason:  "shipped with tracking " + input.TrackingNumber,
+		}, tracking)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only accepted orders can have a tracking number"})
+		return
+	}
+	if err == models.ErrOrderStatusStale {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status has changed, please refresh"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tracking number"})
 		return
@@ -231,29 +205,26 @@ func AcceptOrderBySeller(c *gin.Context) {
 		return
 	}
 
-	// ตรวจว่าเป็นสินค้าของผู้ขายคนนี้
-	var product models.Product
-	err = db.OpenCollection("products").FindOne(ctx, bson.M{"_id": order.Items[0].ProductID}).Decode(&product)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Product not found"})
-		return
-	}
-
-	if product.SellerID != sellerObjID {
+	// ตรวจว่าเป็น order ของผู้ขายคนนี้
+	if !order.BelongsToSeller(sellerObjID) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to accept this order"})
 		return
 	}
 
-	if order.Status != "pending" {
+	if !models.CanTransition(order.Status, models.OrderShipping) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Only 'pending' orders can be accepted"})
 		return
 	}
 
-	_, err = db.OpenCollection("orders").UpdateByID(ctx, objID, bson.M{
-		"$set": bson.M{
-			"status": "shipping",
-		},
-	})
+	_, err = models.TransitionOrder(ctx, objID, order.Status, models.OrderShipping, models.OrderEvent{
+		Actor:   models.ActorSeller,
+		ActorID: sellerObjID,
+		Reason:  "seller accepted order",
+	}, nil)
+	if err == models.ErrOrderStatusStale {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status has changed, please refresh"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept order"})
 		return
@@ -276,7 +247,7 @@ func RejectOrderBySeller(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
 	// ดึง order
@@ -292,32 +263,51 @@ func RejectOrderBySeller(c *gin.Context) {
 		return
 	}
 
-	var product models.Product
-	err = db.OpenCollection("products").FindOne(ctx, bson.M{"_id": order.Items[0].ProductID}).Decode(&product)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Product not found"})
+	if !order.BelongsToSeller(sellerObjID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to reject this order"})
 		return
 	}
 
-	if product.SellerID != sellerObjID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to reject this order"})
-		return
+	// รับเหตุผลการปฏิเสธ (ไม่บังคับ)
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&input)
+	if input.Reason == "" {
+		input.Reason = "seller rejected order"
 	}
 
-	if order.Status != "paid" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only 'paid' orders can be rejected"})
+	if !models.CanTransition(order.Status, models.OrderRejected) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only 'pending' orders can be rejected"})
 		return
 	}
 
-	_, err = db.OpenCollection("orders").UpdateByID(ctx, objID, bson.M{
-		"$set": bson.M{
-			"status": "rejected",
-		},
-	})
+	rejected, err := models.TransitionOrder(ctx, objID, order.Status, models.OrderRejected, models.OrderEvent{
+		Actor:   models.ActorSeller,
+		ActorID: sellerObjID,
+		Reason:  input.Reason,
+	}, nil)
+	if err == models.ErrOrderStatusStale {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status has changed, please refresh"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject order"})
 		return
 	}
 
+	// นำสินค้ากลับมาขาย แล้วคืนเงินผู้ซื้อ
+	if err := models.RestockOrderProducts(ctx, rejected); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order rejected but failed to restock products"})
+		return
+	}
+	if err := refundOrder(ctx, rejected, models.OrderEvent{
+		Actor:  models.ActorSystem,
+		Reason: "refund after seller rejection",
+	}); err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Order rejected, refund will be retried", "refund_error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Order rejected successfully"})
 }
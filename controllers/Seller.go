@@ -3,15 +3,13 @@ package controllers
 import (
 	"arttoy-hub/database"
 	"arttoy-hub/models"
+	"arttoy-hub/payments"
 	"context"
 	"github.com/gin-gonic/gin"
-	"github.com/omise/omise-go"
-	"github.com/omise/omise-go/operations"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
-	"os"
 	"fmt"
 	"time"
 )
@@ -45,10 +43,12 @@ func BecomeSeller(c *gin.Context) {
 		return
 	}
 
-	// อัปโหลดไป GCS
-	idCardImageURL, err := UploadImageToGCS(file, "image/jpeg", "id_card_image")
+	defer file.Close()
+
+	// อัปโหลดรูปบัตรไป private storage (ตรวจชนิดไฟล์จริงและตัด EXIF) admin ดูได้ผ่าน signed URL เท่านั้น
+	idCardImageKey, err := UploadPrivateImage(file, "id_card_image")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image to GCS: " + err.Error()})
+		respondUploadError(c, err)
 		return
 	}
 
@@ -62,7 +62,7 @@ func BecomeSeller(c *gin.Context) {
 	fmt.Println("✅ bank_name:", req.BankName)
 	req.BankAccountNumber = c.PostForm("bank_account_number")
 	req.CitizenID = c.PostForm("citizen_id")
-	req.IDCardImageURL = idCardImageURL
+	req.IDCardImageKey = idCardImageKey
 	// สร้าง map ธนาคารให้ตรงกับ Omise
 	var bankMap = map[string]string{
 		"กสิกรไทย":   "kbank",
@@ -118,24 +118,10 @@ func BecomeSeller(c *gin.Context) {
 	}
 
 	// สร้าง Omise Recipient
-	client, err := omise.NewClient(
-		os.Getenv("OMISE_PUBLIC_KEY"),
-		os.Getenv("OMISE_SECRET_KEY"),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Omise client init failed"})
-		return
-	}
-
-	recipient := &omise.Recipient{}
-	err = client.Do(recipient, &operations.CreateRecipient{
-		Name: req.BankAccountName,
-		Type: "individual",
-		BankAccount: &omise.BankAccountRequest{
-			Brand:  brandCode,
-			Number: req.BankAccountNumber,
-			Name:   req.BankAccountName,
-		},
+	recipient, err := paymentProvider.CreateRecipient(ctx, req.BankAccountName, payments.BankAccount{
+		Brand:  brandCode,
+		Number: req.BankAccountNumber,
+		Name:   req.BankAccountName,
 	})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create recipient in Omise: " + err.Error()})
@@ -149,7 +135,7 @@ func BecomeSeller(c *gin.Context) {
 		BankName:          req.BankName,
 		BankAccountNumber: req.BankAccountNumber,
 		CitizenID:         req.CitizenID,
-		IDCardImageURL:    req.IDCardImageURL,
+		IDCardImageKey:    req.IDCardImageKey,
 		IsVerified:        true,
 		RecipientID:       recipient.ID,
 	}
@@ -160,6 +146,7 @@ func BecomeSeller(c *gin.Context) {
 			"is_seller":   true,
 			"seller_info": sellerInfo,
 		},
+		"$addToSet": bson.M{"roles": models.RoleSeller},
 	}
 	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": userObjID}, update)
 	if err != nil {
@@ -171,6 +158,9 @@ func BecomeSeller(c *gin.Context) {
 		return
 	}
 
+	// ออก access token ใหม่ให้มีบทบาท seller ทันที ไม่ต้องรอ refresh
+	refreshAccessToken(ctx, c, userObjID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Become seller success!",
 		"recipient_id": recipient.ID,
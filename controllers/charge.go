@@ -2,23 +2,19 @@ package controllers
 
 import (
     "net/http"
-    "os"
 
+    "arttoy-hub/payments"
     "github.com/gin-gonic/gin"
-    "github.com/omise/omise-go"
-    "github.com/omise/omise-go/operations"
 )
 
-func CreateTestCharge(c *gin.Context) {
-    client, err := omise.NewClient(
-        os.Getenv("OMISE_PUBLIC_KEY"),
-        os.Getenv("OMISE_SECRET_KEY"),
-    )
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Omise client init failed"})
-        return
-    }
+// provider สำหรับรับ/จ่ายเงิน ตั้งค่าจาก main ผ่าน InitPayments
+var paymentProvider payments.Provider
+
+func InitPayments(provider payments.Provider) {
+    paymentProvider = provider
+}
 
+func CreateTestCharge(c *gin.Context) {
     var req struct {
         Amount int64  `json:"amount"` // 500.00 = 50000
         Token  string `json:"token"`  // เช่น "tokn_test_visa_4242"
@@ -29,14 +25,12 @@ func CreateTestCharge(c *gin.Context) {
         return
     }
 
-    charge := &omise.Charge{}
-    op := &operations.CreateCharge{
-        Amount:   req.Amount,
-        Currency: "thb",
-        Card:     req.Token,
-    }
-
-    if err := client.Do(charge, op); err != nil {
+    charge, err := paymentProvider.CreateCharge(c.Request.Context(), payments.ChargeRequest{
+        Amount:    req.Amount,
+        Currency:  "thb",
+        CardToken: req.Token,
+    })
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"arttoy-hub/storage"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// folder ที่ระบบจัดการเอง ไฟล์อื่นใน bucket จะไม่ถูกแตะ
+var (
+	publicImageFolders  = []string{"product_images/", "profile/", "id_card_image/", uploadStagingFolder + "/"}
+	privateImageFolders = []string{"id_card_image/"}
+)
+
+// รายงานแสดงได้ไม่เกินจำนวนนี้ ตัวเลขสรุปยังนับครบ
+const maxReportedOrphans = 500
+
+type OrphanedObject struct {
+	Store   string    `json:"store"` // public หรือ private
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	Updated time.Time `json:"updated"`
+}
+
+type ImageSweepReport struct {
+	DryRun      bool             `json:"dry_run"`
+	GracePeriod string           `json:"grace_period"`
+	Scanned     int              `json:"scanned"`
+	Orphaned    int              `json:"orphaned"`
+	TooRecent   int              `json:"too_recent"` // ไม่มีใครอ้างถึงแต่ยังอยู่ในช่วง grace period
+	Deleted     int              `json:"deleted"`
+	Failed      int              `json:"failed"`
+	Bytes       int64            `json:"bytes"`
+	Objects     []OrphanedObject `json:"objects"`
+	StartedAt   time.Time        `json:"started_at"`
+	FinishedAt  time.Time        `json:"finished_at"`
+}
+
+// ไฟล์ที่ไม่มีใครอ้างถึงต้องเก่ากว่านี้ก่อนถึงจะลบ กันรูปที่เพิ่งอัปโหลดแต่สินค้ายังบันทึกไม่เสร็จ
+func imageGCGracePeriod() time.Duration {
+	if grace, err := time.ParseDuration(os.Getenv("IMAGE_GC_GRACE")); err == nil && grace >= time.Hour {
+		return grace
+	}
+	return 72 * time.Hour
+}
+
+// key ของทุกไฟล์ที่ยังถูกอ้างถึงจาก products, upload_sessions และ users แยกตาม store
+func referencedImageKeys(ctx context.Context) (public, private map[string]bool, err error) {
+	public = map[string]bool{}
+	private = map[string]bool{}
+	addURL := func(url string) {
+		if key, ok := objectStore.KeyFromURL(url); ok {
+			public[key] = true
+		}
+	}
+
+	cursor, err := db.ProductCollection.Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"product_image": 1, "image_variants": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			cursor.Close(ctx)
+			return nil, nil, err
+		}
+		for _, url := range product.ImageURLs {
+			addURL(url)
+		}
+		for _, v := range product.ImageVariants {
+			addURL(v.Original)
+			addURL(v.Thumbnail)
+			addURL(v.Medium)
+			addURL(v.WebP)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		cursor.Close(ctx)
+		return nil, nil, err
+	}
+	cursor.Close(ctx)
+
+	// รูปของ upload session ที่ยังไม่หมดอายุ รอผูกกับสินค้าอยู่ (อาจนานกว่า grace period)
+	cursor, err = models.UploadSessionCollection().Find(ctx, bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetProjection(bson.M{"keys": 1, "images": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	for cursor.Next(ctx) {
+		var session models.UploadSession
+		if err := cursor.Decode(&session); err != nil {
+			cursor.Close(ctx)
+			return nil, nil, err
+		}
+		for _, key := range session.Keys {
+			public[key] = true
+		}
+		for _, v := range session.Images {
+			addURL(v.Original)
+			addURL(v.Thumbnail)
+			addURL(v.Medium)
+			addURL(v.WebP)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		cursor.Close(ctx)
+		return nil, nil, err
+	}
+	cursor.Close(ctx)
+
+	cursor, err = db.OpenCollection("users").Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{
+			"profile_image":                 1,
+			"seller_info.id_card_image_key": 1,
+			"seller_info.id_card_image_url": 1,
+		}))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, nil, err
+		}
+		addURL(user.ProfileImage)
+		if user.SellerInfo != nil {
+			addURL(user.SellerInfo.IDCardImageURL)
+			if user.SellerInfo.IDCardImageKey != "" {
+				private[user.SellerInfo.IDCardImageKey] = true
+			}
+		}
+	}
+	return public, private, cursor.Err()
+}
+
+// SweepOrphanedImages หาไฟล์ที่ไม่มีสินค้าหรือผู้ใช้คนไหนอ้างถึงและเก่ากว่า grace แล้วลบ
+// dryRun = รายงานอย่างเดียว ไม่ลบ
+func SweepOrphanedImages(ctx context.Context, dryRun bool, grace time.Duration) (ImageSweepReport, error) {
+	report := ImageSweepReport{DryRun: dryRun, GracePeriod: grace.String(), Objects: []OrphanedObject{}, StartedAt: time.Now()}
+	if objectStore == nil {
+		return report, errors.New("storage is not configured")
+	}
+	// ถ้าอ่าน reference ไม่ครบจะไม่ลบอะไรเลย
+	publicRefs, privateRefs, err := referencedImageKeys(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	cutoff := time.Now().Add(-grace)
+	sweep := func(name string, store storage.ObjectStore, folders []string, refs map[string]bool) error {
+		for _, folder := range folders {
+			err := store.List(ctx, folder, func(obj storage.ObjectInfo) error {
+				report.Scanned++
+				if refs[obj.Key] {
+					return nil
+				}
+				if obj.Updated.After(cutoff) {
+					report.TooRecent++
+					return nil
+				}
+				report.Orphaned++
+				report.Bytes += obj.Size
+				if len(report.Objects) < maxReportedOrphans {
+					report.Objects = append(report.Objects, OrphanedObject{Store: name, Key: obj.Key, Size: obj.Size, Updated: obj.Updated})
+				}
+				if dryRun {
+					return nil
+				}
+				if err := store.Delete(ctx, obj.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+					log.Printf("❌ Failed to delete orphaned %s object %s: %v", name, obj.Key, err)
+					report.Failed++
+					return nil
+				}
+				report.Deleted++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := sweep("public", objectStore, publicImageFolders, publicRefs); err != nil {
+		return report, err
+	}
+	if privateStore != nil {
+		if err := sweep("private", privateStore, privateImageFolders, privateRefs); err != nil {
+			return report, err
+		}
+	}
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// cron: ลบรูปที่ไม่มีใครใช้ IMAGE_GC_DRY_RUN=true จะแค่ log รายงาน
+func RunImageSweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	dryRun := os.Getenv("IMAGE_GC_DRY_RUN") == "true"
+	report, err := SweepOrphanedImages(ctx, dryRun, imageGCGracePeriod())
+	if err != nil {
+		log.Printf("❌ Image sweep failed: %v", err)
+		return
+	}
+	if dryRun {
+		log.Printf("⚠️ Image sweep (dry run): %d orphaned objects (%d bytes) would be deleted, %d scanned", report.Orphaned, report.Bytes, report.Scanned)
+		for _, obj := range report.Objects {
+			log.Printf("   %s %s (%d bytes, %s)", obj.Store, obj.Key, obj.Size, obj.Updated.Format(time.RFC3339))
+		}
+		return
+	}
+	log.Printf("✅ Image sweep: deleted %d orphaned objects (%d bytes), %d failed, %d scanned", report.Deleted, report.Bytes, report.Failed, report.Scanned)
+}
+
+// admin ดูรายงานไฟล์ที่จะถูกลบ (dry run ไม่ลบจริง)
+func GetOrphanedImages(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	report, err := SweepOrphanedImages(ctx, true, imageGCGracePeriod())
+	if err != nil {
+		log.Printf("❌ Image sweep report failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// admin สั่งลบไฟล์ที่ไม่มีใครใช้ทันที (ยังเคารพ grace period)
+func SweepOrphanedImagesNow(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := SweepOrphanedImages(ctx, false, imageGCGracePeriod())
+	if err != nil {
+		log.Printf("❌ Image sweep failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sweep images"})
+		return
+	}
+	log.Printf("✅ Admin %s swept %d orphaned objects", c.GetString("user_id"), report.Deleted)
+	c.JSON(http.StatusOK, report)
+}
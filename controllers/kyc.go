@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// อายุของ URL ดูรูปบัตรประชาชน ตั้งได้ด้วย KYC_URL_TTL (เช่น 2m) ไม่เกิน 15 นาที
+func kycURLTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("KYC_URL_TTL")); err == nil && ttl > 0 && ttl <= 15*time.Minute {
+		return ttl
+	}
+	return 5 * time.Minute
+}
+
+// admin ขอ URL ชั่วคราวสำหรับดูรูปบัตรประชาชนของผู้ขาย ทุกครั้งจะถูกบันทึกใน kyc_access_logs
+// GET /api/admin/sellers/:id/id-card?reason=...
+func GetSellerIDCardURL(c *gin.Context) {
+	sellerObjID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seller ID"})
+		return
+	}
+	adminObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if privateStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Private storage is not configured"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var seller models.User
+	err = db.OpenCollection("users").FindOne(ctx, bson.M{"_id": sellerObjID},
+		options.FindOne().SetProjection(bson.M{"seller_info.id_card_image_key": 1}),
+	).Decode(&seller)
+	if err != nil || seller.SellerInfo == nil || seller.SellerInfo.IDCardImageKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ID card image not found"})
+		return
+	}
+
+	ttl := kycURLTTL()
+	expiresAt := time.Now().Add(ttl)
+	url, err := privateStore.SignedURL(ctx, seller.SellerInfo.IDCardImageKey, http.MethodGet, ttl)
+	if err != nil {
+		log.Printf("❌ Failed to sign ID card URL for seller %s: %v\n", sellerObjID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create URL"})
+		return
+	}
+
+	// บันทึกไม่สำเร็จ = ไม่ออก URL ให้ ต้องตรวจย้อนหลังได้เสมอว่าใครเปิดดู
+	err = models.LogKYCAccess(ctx, models.KYCAccessLog{
+		AdminID:   adminObjID,
+		SellerID:  sellerObjID,
+		Document:  models.KYCDocumentIDCard,
+		Reason:    c.Query("reason"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("❌ Failed to log KYC access: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log access"})
+		return
+	}
+	log.Printf("✅ Admin %s opened ID card of seller %s\n", adminObjID.Hex(), sellerObjID.Hex())
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": expiresAt})
+}
+
+// ประวัติการเปิดดูเอกสาร KYC ของผู้ขาย
+func GetSellerKYCAccessLogs(c *gin.Context) {
+	sellerObjID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seller ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logs, err := models.ListKYCAccessLogs(ctx, sellerObjID, 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load access logs"})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+// MigrateIDCardImages ย้ายรูปบัตรประชาชนแบบเก่าที่อยู่ใน storage สาธารณะไป private storage
+// แล้วลบไฟล์สาธารณะทิ้ง เรียกซ้ำได้
+func MigrateIDCardImages(ctx context.Context) (int, error) {
+	users := db.OpenCollection("users")
+	cursor, err := users.Find(ctx, bson.M{
+		"seller_info.id_card_image_url": bson.M{"$nin": bson.A{"", nil}},
+		"seller_info.id_card_image_key": bson.M{"$exists": false},
+	}, options.Find().SetProjection(bson.M{"seller_info.id_card_image_url": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var sellers []models.User
+	if err := cursor.All(ctx, &sellers); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, seller := range sellers {
+		url := seller.SellerInfo.IDCardImageURL
+		key, ok := objectStore.KeyFromURL(url)
+		if !ok {
+			log.Printf("⚠️ ID card of seller %s is not in our storage, skipped: %s\n", seller.ID.Hex(), url)
+			continue
+		}
+		if err := copyToPrivate(ctx, key); err != nil {
+			log.Printf("❌ Failed to move ID card of seller %s: %v\n", seller.ID.Hex(), err)
+			continue
+		}
+		_, err := users.UpdateByID(ctx, seller.ID, bson.M{
+			"$set":   bson.M{"seller_info.id_card_image_key": key},
+			"$unset": bson.M{"seller_info.id_card_image_url": ""},
+		})
+		if err != nil {
+			return moved, err
+		}
+		if err := objectStore.Delete(ctx, key); err != nil {
+			log.Printf("⚠️ Failed to delete public ID card %s: %v\n", key, err)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+func copyToPrivate(ctx context.Context, key string) error {
+	reader, err := objectStore.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	info, err := objectStore.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = privateStore.Put(ctx, key, reader, info.ContentType)
+	return err
+}
@@ -3,18 +3,18 @@ package controllers
 import (
     "context"
     "net/http"
-    "os"
+    "strings"
     "time"
+    "arttoy-hub/middleware"
     "arttoy-hub/models"
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
     "golang.org/x/crypto/bcrypt"
-    "github.com/golang-jwt/jwt/v4"
-    "fmt"
 )
 var collection *mongo.Collection
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
 // ตรวจสอบพาสเวิร์ด
 func checkPasswordHash(password, hash string) bool {
@@ -22,19 +22,14 @@ func checkPasswordHash(password, hash string) bool {
     return err == nil
 }
 
-// สร้าง JWT Token
-func generateJWT(userID string) (string, error) {
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-        "user_id": userID,
-        "exp":     time.Now().Add(time.Hour * 24).Unix(),
-    })
-    return token.SignedString(jwtSecret)
-}
-
-// Handler สำหรับ Login ด้วยเบอร์โทรศัพท์ + รหัสผ่าน
+// Handler สำหรับ Login ด้วยเบอร์โทรศัพท์, gmail หรือ username + รหัสผ่าน
+// ส่ง identifier อย่างเดียว หรือระบุ field ตรง ๆ (phonenumber / gmail / username) ก็ได้
 func Login(c *gin.Context) {
     type LoginInput struct {
-        Phonenumber string `json:"phonenumber" binding:"required"`
+        Identifier  string `json:"identifier"`
+        Phonenumber string `json:"phonenumber"`
+        Gmail       string `json:"gmail"`
+        Username    string `json:"username"`
         Password    string `json:"password" binding:"required"`
     }
 
@@ -43,33 +38,110 @@ func Login(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
         return
     }
+    filters := loginFilters(input.Identifier, input.Phonenumber, input.Gmail, input.Username)
+    if len(filters) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Phone number, gmail or username is required"})
+        return
+    }
 
-    // ค้นหาผู้ใช้ตามเบอร์โทรศัพท์
+    // ค้นหาผู้ใช้ ลองตามลำดับ เบอร์โทร -> gmail -> username
     var user models.User
-    err := collection.FindOne(context.Background(), bson.M{"phonenumber": input.Phonenumber}).Decode(&user)
+    err := mongo.ErrNoDocuments
+    for _, filter := range filters {
+        if err = collection.FindOne(context.Background(), filter).Decode(&user); err != mongo.ErrNoDocuments {
+            break
+        }
+    }
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid phone number or password"})
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
         return
     }
 
     // ตรวจสอบพาสเวิร์ด
     if !checkPasswordHash(input.Password, user.Password) {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid phone number or password"})
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    // เปิด 2FA ไว้ ต้องยืนยันรหัสจากแอปอีกขั้นที่ POST /Login/2fa
+    if user.TwoFactorEnabled() {
+        startTwoFactorChallenge(ctx, c, user)
         return
     }
+    completeLogin(ctx, c, user)
+}
 
-    // สร้าง JWT Token
-    token, err := generateJWT(user.ID.Hex())
+// สร้าง session ใหม่ ได้ access token อายุสั้น + refresh token แล้วตั้ง cookie
+func completeLogin(ctx context.Context, c *gin.Context, user models.User) {
+    token, expiresAt, refresh, err := startSession(ctx, c, user.ID, user.EffectiveRoles())
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
     }
     // ตั้งค่า cookie
-    c.SetCookie("token", token, 3600*24, "/", "", false, true)
-    // c.Writer.Header().Set("Set-Cookie", fmt.Sprintf("token=%s; SameSite=Lax; Path=/; HttpOnly", token))
-    c.Writer.Header().Set("Set-Cookie", fmt.Sprintf("token=%s; SameSite=Lax; Path=/;", token)) // ลบ HttpOnly ออก
+    csrf := setSessionCookies(c, token, refresh)
+    // ให้ middleware ล้างตัวนับ login ผิดหลังได้ session แล้วเท่านั้น
+    c.Set(middlewares.LoginCompleteKey, user.ID.Hex())
+
+    // client ที่ไม่ใช้ cookie (mobile, script) ส่ง token ใน header Authorization: Bearer
+    response := gin.H{
+        "message":    "Login successful",
+        "token":      token,
+        "token_type": "Bearer",
+        "expires_at": expiresAt,
+        "expires_in": int(accessTokenTTL.Seconds()),
+        "csrf_token": csrf,
+    }
+    // browser ได้ refresh token ทาง cookie HttpOnly เท่านั้น
+    if bearerClient(c) {
+        response["refresh_token"] = refresh
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// หา user ID จาก body ของ /Login ด้วยลำดับเดียวกับ Login ใช้เป็น key ล็อกบัญชี
+func LoginUserID(ctx context.Context, body map[string]interface{}) (string, error) {
+    field := func(name string) string {
+        value, _ := body[name].(string)
+        return value
+    }
+    filters := loginFilters(field("identifier"), field("phonenumber"), field("gmail"), field("username"))
+    for _, filter := range filters {
+        var user struct {
+            ID primitive.ObjectID `bson:"_id"`
+        }
+        err := collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&user)
+        if err == mongo.ErrNoDocuments {
+            continue
+        }
+        if err != nil {
+            return "", err
+        }
+        return user.ID.Hex(), nil
+    }
+    return "", nil
+}
+
+// เงื่อนไขค้นหาผู้ใช้ตาม identifier ที่ส่งมา เรียงตามลำดับที่จะลอง
+func loginFilters(identifier, phonenumber, gmail, username string) []bson.M {
+    var filters []bson.M
+    if phonenumber = strings.TrimSpace(phonenumber); phonenumber != "" {
+        filters = append(filters, bson.M{"phonenumber": phonenumber})
+    }
+    if gmail = strings.TrimSpace(gmail); gmail != "" {
+        filters = append(filters, bson.M{"gmail": bson.M{"$in": []string{gmail, strings.ToLower(gmail)}}})
+    }
+    if username = strings.TrimSpace(username); username != "" {
+        filters = append(filters, bson.M{"username": username})
+    }
+    if identifier = strings.TrimSpace(identifier); identifier != "" {
+        filters = append(filters, loginFilters("", identifier, identifier, identifier)...)
+    }
+    return filters
 }
-// c.Writer.Header().Set("Set-Cookie", fmt.Sprintf("token=%s; SameSite=None; Path=/;", token)) // ลบ HttpOnly ออก
     
 
 
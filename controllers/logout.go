@@ -1,22 +1,28 @@
 package controllers
 
 import (
+    "arttoy-hub/models"
+    "context"
+    "log"
     "net/http"
+    "time"
 
     "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func Logout(c *gin.Context) {
-    // ลบ cookie ที่ชื่อว่า "token"
-    c.SetCookie(
-        "token",     // ชื่อ cookie
-        "",          // ค่าใหม่ = ค่าว่าง
-        -1,          // อายุ cookie = หมดอายุทันที
-        "/",         // path
-        "localhost", // domain (แก้ทีหลังถ้า deploy จริง)
-        false,       // secure (false สำหรับ localhost)
-        true,        // httpOnly (กัน javascript อ่าน cookie)
-    )
+    // ยกเลิก session ปัจจุบัน refresh token ของอุปกรณ์นี้จะใช้ต่อไม่ได้
+    if sessionID, err := primitive.ObjectIDFromHex(c.GetString("session_id")); err == nil {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := models.RevokeSession(ctx, sessionID); err != nil {
+            log.Printf("❌ Failed to revoke session %s: %v\n", sessionID.Hex(), err)
+        }
+    }
+
+    // ลบ cookie ของ token, refresh token และ csrf (domain/secure ตาม COOKIE_* ใน env)
+    clearAuthCookies(c)
 
     c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -3,18 +3,15 @@ package controllers
 import (
 	"arttoy-hub/database"
 	"arttoy-hub/models"
-	"bytes"
+	"arttoy-hub/payments"
 	"context"
-	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/omise/omise-go"
-	"github.com/omise/omise-go/operations"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"time"
 )
 
@@ -54,7 +51,7 @@ func GetSellerOrders(c *gin.Context) {
 			},
 		},
 		"status": bson.M{
-			"$in": []string{"pending", "shipping", "processing", "completed"}, // ✅ เฉพาะสถานะที่ต้องแสดง
+			"$in": models.SellerVisibleStatuses, // ✅ เฉพาะสถานะที่ต้องแสดง
 		},
 	})
 	if err != nil {
@@ -69,8 +66,16 @@ func GetSellerOrders(c *gin.Context) {
 		return
 	}
 
-	// เติมข้อมูลสินค้าให้แต่ละ order item
+	// เติมข้อมูลสินค้าให้แต่ละ order item และแสดงเฉพาะยอดของผู้ขายคนนี้
 	for i := range orders {
+		payouts := models.OrderPayouts(orders[i])
+		orders[i].Payouts = nil
+		for _, p := range payouts {
+			if p.SellerID == sellerObjID {
+				orders[i].Payouts = append(orders[i].Payouts, p)
+			}
+		}
+
 		for j := range orders[i].Items {
 			productID := orders[i].Items[j].ProductID
 			var product models.Product
@@ -100,15 +105,85 @@ func GetOrderByID(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
-var charge *omise.Charge
+// ดูประวัติการเปลี่ยนสถานะของ order (ผู้ซื้อหรือผู้ขายใน order เท่านั้น)
+func GetOrderTimeline(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	order, err := models.GetOrderByID(objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	allowed := order.UserID == userObjID
+	for _, item := range order.Items {
+		if item.SellerID == userObjID {
+			allowed = true
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this order"})
+		return
+	}
 
-type QRSourceResponse struct {
-	ID            string `json:"id"`
-	ScannableCode struct {
-		Image struct {
-			URI string `json:"uri"`
-		} `json:"image"`
-	} `json:"scannable_code"`
+	events := order.Events
+	if events == nil {
+		events = []models.OrderEvent{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"order_id": order.ID.Hex(),
+		"status":   order.Status,
+		"events":   events,
+	})
+}
+
+// ดูการจ่ายเงินรวมพร้อม order ย่อยของแต่ละผู้ขาย (เฉพาะผู้ซื้อเจ้าของ)
+func GetCheckout(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checkout ID"})
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var checkout models.Checkout
+	if err := models.CheckoutCollection().FindOne(ctx, bson.M{"_id": objID}).Decode(&checkout); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checkout not found"})
+		return
+	}
+	if checkout.UserID != userObjID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this checkout"})
+		return
+	}
+
+	cursor, err := db.OpenCollection("orders").Find(ctx, bson.M{"checkout_id": checkout.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	orders := []models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"checkout": checkout, "orders": orders})
 }
 
 // สร้าง QR PromptPay Order
@@ -134,19 +209,20 @@ func CreatePromptPayCustomOrder(c *gin.Context) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    // 3) เช็กว่า user ยังไม่มีออเดอร์ค้างในสถานะ unpaid|waiting_payment
+    // 3) เช็กว่า user ยังไม่มีออเดอร์ค้างในสถานะ waiting_payment
     var existing models.Order
     err = db.OpenCollection("orders").FindOne(ctx, bson.M{
         "user_id": userObjID,
-        "status":  bson.M{"$in": []string{"unpaid", "waiting_payment"}},
+        "status":  models.OrderWaitingPayment,
     }).Decode(&existing)
 
     if err == nil {
-        log.Printf("⚠️ Found existing unpaid order: ID=%s, Total=%.2f, Status=%s\n",
+        log.Printf("⚠️ Found existing unpaid order: ID=%s, Total=%s, Status=%s\n",
             existing.ID.Hex(), existing.Total, existing.Status)
         c.JSON(http.StatusBadRequest, gin.H{
-            "error":    "You already have an unpaid order",
-            "order_id": existing.ID.Hex(),
+            "error":       "You already have an unpaid order",
+            "order_id":    existing.ID.Hex(),
+            "checkout_id": existing.CheckoutID.Hex(),
             "total":    existing.Total,
             "status":   existing.Status,
         })
@@ -227,7 +303,7 @@ func CreatePromptPayCustomOrder(c *gin.Context) {
 
     // 8) คำนวณรวมราคาสินค้า และตรวจเช็กว่าแต่ละ product ยังไม่ถูกขาย
     var orderItems []models.OrderItem
-    var total float64
+    var total models.Money
     for _, item := range input.Items {
         productObjID, err := primitive.ObjectIDFromHex(item.ID)
         if err != nil {
@@ -248,6 +324,11 @@ func CreatePromptPayCustomOrder(c *gin.Context) {
             c.JSON(http.StatusBadRequest, gin.H{"error": "Product already sold: " + item.ID})
             return
         }
+        if !product.ReservedBy.IsZero() {
+            log.Printf("❌ Product reserved by order %s: %s\n", product.ReservedBy.Hex(), item.ID)
+            c.JSON(http.StatusConflict, gin.H{"error": "Product is reserved by another buyer: " + item.ID})
+            return
+        }
 
         qty := item.Quantity
         if qty <= 0 {
@@ -259,104 +340,104 @@ func CreatePromptPayCustomOrder(c *gin.Context) {
             SellerID:  product.SellerID,
             Price:     product.Price,
             Quantity:  qty,
+            Category:  product.Category,
         })
-        total += product.Price * float64(qty)
+        total += product.Price.Times(qty)
     }
 
-    // 9) กำหนดค่าส่งและคำนวณ GrandTotal
-    shippingFee := 40.0
-    grandTotal := total + shippingFee
-
-    // 10) สร้าง QR PromptPay กับ Omise (Create Source)
-    payload := map[string]interface{}{
-        "amount":   int(grandTotal * 100),
-        "currency": "thb",
-        "type":     "promptpay",
+    // 9) แยกสินค้าเป็น order ย่อยต่อผู้ขาย แต่ละ order คิดค่าส่งของตัวเอง
+    now := time.Now()
+    orders := models.SplitOrderBySeller(models.Order{
+        UserID:          userObjID,
+        Status:          models.OrderWaitingPayment,
+        ShippingAddress: *selectedAddr,
+        CreatedAt:       now,
+        ExpiredAt:       now.Add(1 * time.Minute),
+    }, orderItems, models.Fees.ShippingFee)
+
+    var shippingFee, grandTotal models.Money
+    for i := range orders {
+        shippingFee += orders[i].ShippingFee
+        grandTotal += orders[i].GrandTotal
     }
-    bodyBytes, _ := json.Marshal(payload)
-    reqOmise, _ := http.NewRequest("POST", "https://api.omise.co/sources", bytes.NewBuffer(bodyBytes))
-    reqOmise.SetBasicAuth(os.Getenv("OMISE_PUBLIC_KEY"), "")
-    reqOmise.Header.Set("Content-Type", "application/json")
 
-    respOmise, err := http.DefaultClient.Do(reqOmise)
-    if err != nil {
-        log.Printf("❌ Omise Create Source request failed: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create QR source"})
-        return
+    // 10) สร้าง checkout และ order ย่อยใน MongoDB พร้อมจองสินค้าก่อน (transaction เดียวกัน กันผู้ซื้อสองคนจ่ายชิ้นเดียวกัน)
+    // จองก่อนสร้าง charge คนที่แย่งจองไม่ได้จะไม่เหลือ charge ค้างที่ Omise
+    for i := range orders {
+        // คำนวณค่าคอมมิชชันและยอดสุทธิของผู้ขายไว้ตั้งแต่ตอนซื้อ
+        models.Fees.Apply(&orders[i])
     }
-    defer respOmise.Body.Close()
-    if respOmise.StatusCode != http.StatusOK {
-        rawBody, _ := ioutil.ReadAll(respOmise.Body)
-        log.Printf("❌ Omise Create Source returned status %d: %s\n", respOmise.StatusCode, string(rawBody))
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Omise Create Source failed"})
+    checkout, newOrders, err := models.CreateCheckoutWithReservation(ctx, models.Checkout{
+        UserID:          userObjID,
+        Total:           total,
+        ShippingFee:     shippingFee,
+        GrandTotal:      grandTotal,
+        Status:          models.CheckoutWaitingPayment,
+        ShippingAddress: *selectedAddr,
+        ExpiredAt:       orders[0].ExpiredAt,
+    }, orders)
+    if errors.Is(err, models.ErrProductUnavailable) {
+        log.Printf("❌ Reservation failed, product taken by another order\n")
+        c.JSON(http.StatusConflict, gin.H{"error": "Some products were just sold or reserved by another buyer"})
         return
     }
-
-    var qr QRSourceResponse
-    respBytes, _ := ioutil.ReadAll(respOmise.Body)
-    if err := json.Unmarshal(respBytes, &qr); err != nil {
-        log.Printf("❌ Failed to unmarshal QR response: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse QR response"})
+    if err != nil {
+        log.Printf("❌ CreateOrder DB failed: %v\n", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Create order failed"})
         return
     }
-    log.Printf("✅ QR Source ID = %s\n", qr.ID)
+    log.Printf("✅ New checkout created: ID=%s with %d orders\n", checkout.ID.Hex(), len(newOrders))
 
-    // 11) สร้าง Charge กับ Omise (Create Charge)
-    client, err := omise.NewClient(os.Getenv("OMISE_PUBLIC_KEY"), os.Getenv("OMISE_SECRET_KEY"))
+    // 11) สร้าง QR PromptPay กับ Omise (Create Source) ครั้งเดียวสำหรับทุก order ย่อย
+    amount := grandTotal.Satang()
+    source, err := paymentProvider.CreatePromptPaySource(ctx, amount)
     if err != nil {
-        log.Printf("❌ Omise client init failed: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Omise client init failed"})
+        log.Printf("❌ Create Source failed: %v\n", err)
+        abandonCheckout(checkout, newOrders, "failed to create QR source")
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create QR source"})
         return
     }
+    log.Printf("✅ QR Source ID = %s\n", source.ID)
 
-    chargeOp := &operations.CreateCharge{
-        Amount:   int64(grandTotal * 100),
+    // 12) สร้าง Charge กับ Omise (Create Charge) แล้วผูกกับ checkout และ order ย่อย
+    charge, err := paymentProvider.CreateCharge(ctx, payments.ChargeRequest{
+        Amount:   amount,
         Currency: "thb",
-        Source:   qr.ID,
-    }
-
-    var charge omise.Charge
-    if err := client.Do(&charge, chargeOp); err != nil {
+        SourceID: source.ID,
+    })
+    if err != nil {
         log.Printf("❌ Create Charge failed: %v\n", err)
+        abandonCheckout(checkout, newOrders, "failed to create charge")
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Create charge failed: " + err.Error()})
         return
     }
     log.Printf("✅ Created Omise charge ID = %s\n", charge.ID)
 
-    // 12) สร้าง Order ใน MongoDB
-    order := models.Order{
-        UserID:          userObjID,
-        Items:           orderItems,
-        Total:           total,
-        ShippingFee:     shippingFee,
-        GrandTotal:      grandTotal,
-        Status:          "waiting_payment",
-        SourceID:        qr.ID,
-        ChargeID:        charge.ID,
-        ShippingAddress: *selectedAddr,
-        CreatedAt:       time.Now(),
-        ExpiredAt:       time.Now().Add(1 * time.Minute),
-    }
-
-    newOrder, err := models.CreateOrder(order)
-    if err != nil {
-        log.Printf("❌ CreateOrder DB failed: %v\n", err)
+    if err := models.AttachCheckoutCharge(ctx, checkout, source.ID, charge.ID); err != nil {
+        // charge ที่ไม่มี order ผูกอยู่จะหมดอายุเองเพราะผู้ซื้อไม่ได้รับ QR
+        log.Printf("❌ Failed to attach charge %s to checkout %s: %v\n", charge.ID, checkout.ID.Hex(), err)
+        abandonCheckout(checkout, newOrders, "failed to attach charge")
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Create order failed"})
         return
     }
-    log.Printf("✅ New order created: ID=%s\n", newOrder.ID.Hex())
+    checkout.SourceID, checkout.ChargeID = source.ID, charge.ID
+    for i := range newOrders {
+        newOrders[i].SourceID, newOrders[i].ChargeID = source.ID, charge.ID
+    }
 
     // 13) เตรียมค่า qrImage กลับไปให้ frontend
-    qrImage := qr.ScannableCode.Image.URI
+    qrImage := source.QRImageURL
     if qrImage == "" {
         qrImage = "https://cdn.omise.co/scannable_code/test_qr.png"
     }
 
-    // 14) ส่ง response กลับ
+    // 14) ส่ง response กลับ (order_id คือ order ย่อยแรก ใช้กับ endpoint เดิมได้)
     c.JSON(http.StatusOK, gin.H{
-        "order_id":     newOrder.ID.Hex(),
+        "checkout_id":  checkout.ID.Hex(),
+        "order_id":     newOrders[0].ID.Hex(),
+        "orders":       newOrders,
         "qr_image":     qrImage,
-        "source_id":    qr.ID,
+        "source_id":    source.ID,
         "charge_id":    charge.ID,
         "total":        total,
         "shipping_fee": shippingFee,
@@ -366,6 +447,22 @@ func CreatePromptPayCustomOrder(c *gin.Context) {
 }
 
 
+// สร้าง charge ไม่สำเร็จหลังจองสินค้าแล้ว ให้ order หมดอายุและปล่อยสินค้าทันที ไม่ต้องรอ cron
+func abandonCheckout(checkout models.Checkout, orders []models.Order, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event := models.OrderEvent{Actor: models.ActorSystem, Reason: reason}
+	for _, order := range orders {
+		if _, err := markOrderExpired(ctx, order.ID, event); err != nil {
+			log.Printf("❌ Failed to expire order %s: %v\n", order.ID.Hex(), err)
+		}
+	}
+	if err := models.SetCheckoutStatus(ctx, checkout.ID, models.CheckoutExpired); err != nil {
+		log.Printf("❌ Failed to expire checkout %s: %v\n", checkout.ID.Hex(), err)
+	}
+}
+
 // ม็อคว่า “จ่ายแล้ว” (เฉพาะ test mode)
 func MarkPromptPayOrderPaid(c *gin.Context) {
 	orderID := c.Param("id")
@@ -382,7 +479,7 @@ func MarkPromptPayOrderPaid(c *gin.Context) {
 		return
 	}
 
-	if order.Status != "waiting_payment" {
+	if order.Status != models.OrderWaitingPayment {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Order not in waiting_payment state"})
 		return
 	}
@@ -393,42 +490,70 @@ func MarkPromptPayOrderPaid(c *gin.Context) {
 		return
 	}
 
-	// ✅ แจ้ง Omise (mocked, ไม่มี check response)
-	req, _ := http.NewRequest("POST", "https://api.omise.co/sources/"+order.SourceID+"/mark_as_paid", nil)
-	req.SetBasicAuth(os.Getenv("OMISE_SECRET_KEY"), "")
-	http.DefaultClient.Do(req)
-
-	// ✅ อัปเดต order เป็น paid/pending
-	db.OpenCollection("orders").UpdateByID(ctx, objID, bson.M{
-		"$set": bson.M{
-			"status":  "pending",
-			"paid_at": time.Now(),
-		},
-	})
+	// ✅ แจ้ง Omise (test mode) ว่า charge นี้จ่ายแล้ว
+	if err := paymentProvider.MarkChargePaid(ctx, order.ChargeID); err != nil {
+		log.Printf("❌ Mark charge paid failed: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark charge as paid"})
+		return
+	}
 
-	// ✅ ตั้ง is_sold ให้สินค้าใน order
-	for _, item := range order.Items {
-		db.OpenCollection("products").UpdateByID(ctx, item.ProductID, bson.M{
-			"$set": bson.M{"is_sold": true},
-		})
+	// ✅ อัปเดตทุก order ย่อยของ charge นี้เป็น pending + ตั้ง is_sold (ใช้ร่วมกับ webhook กันอัปเดตซ้ำ)
+	if _, err := markChargePaid(ctx, bson.M{"charge_id": order.ChargeID}, models.OrderEvent{
+		Actor:   models.ActorBuyer,
+		ActorID: userObjID,
+		Reason:  "mark paid (test mode)",
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Order marked as paid"})
 }
-func DeleteExpiredOrders() {
+// order ที่เลยเวลาจ่ายเงินเปลี่ยนเป็น expired และปล่อยสินค้าที่จองไว้ เอกสาร order ยังเก็บไว้
+// ถ้าเงินเข้ามาทีหลัง webhook จะเจอ order ที่ expired แล้วคืนเงินให้อัตโนมัติ (refundLatePayment)
+func ExpireUnpaidOrders() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	filter := bson.M{
-		"status":     "waiting_payment",
+		"status":     models.OrderWaitingPayment,
 		"expired_at": bson.M{"$lt": time.Now()},
 	}
 
-	result, err := db.OpenCollection("orders").DeleteMany(ctx, filter)
+	cursor, err := db.OpenCollection("orders").Find(ctx, filter)
 	if err != nil {
-		log.Printf("❌ Failed to delete expired orders: %v", err)
+		log.Printf("❌ Failed to find expired orders: %v", err)
+		return
+	}
+	var expired []models.Order
+	if err := cursor.All(ctx, &expired); err != nil {
+		log.Printf("❌ Failed to decode expired orders: %v", err)
 		return
 	}
 
-	log.Printf("✅ Deleted %v expired orders", result.DeletedCount)
-}
\ No newline at end of file
+	var changed int
+	for _, order := range expired {
+		// เปลี่ยนสถานะก่อนแล้วค่อยปล่อยสินค้า ถ้าเงินเข้าพร้อมกันจะมีฝั่งเดียวที่เปลี่ยนสถานะได้
+		ok, err := markOrderExpired(ctx, order.ID, models.OrderEvent{
+			Actor:  models.ActorSystem,
+			Reason: "payment window expired",
+		})
+		if err != nil {
+			log.Printf("❌ Failed to expire order %s: %v", order.ID.Hex(), err)
+			continue
+		}
+		if ok {
+			changed++
+		}
+	}
+
+	// checkout ที่หมดเวลาจ่ายแล้วเปลี่ยนเป็น expired ตาม order ย่อย
+	if _, err := models.CheckoutCollection().UpdateMany(ctx, bson.M{
+		"status":     models.CheckoutWaitingPayment,
+		"expired_at": bson.M{"$lt": time.Now()},
+	}, bson.M{"$set": bson.M{"status": models.CheckoutExpired}}); err != nil {
+		log.Printf("❌ Failed to expire checkouts: %v", err)
+	}
+
+	log.Printf("✅ Expired %d unpaid orders", changed)
+}
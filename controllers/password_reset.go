@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"arttoy-hub/utils"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	passwordResetValidFor = 30 * time.Minute
+	passwordResetCooldown = 60 * time.Second
+)
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ขอตั้งรหัสผ่านใหม่ ส่ง token ไปที่อีเมล
+// ตอบเหมือนกันทุกกรณีเพื่อไม่ให้รู้ว่าอีเมลไหนมีบัญชีอยู่
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Gmail string `json:"gmail" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	response := gin.H{"message": "If the email is registered, a reset code has been sent"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := db.OpenCollection("users").FindOne(ctx, bson.M{"gmail": input.Gmail}).Decode(&user); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("❌ Failed to look up user for password reset: %v\n", err)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// ขอซ้ำถี่ ๆ จะไม่ส่งอีเมลใหม่
+	now := time.Now()
+	var latest models.PasswordReset
+	err := models.PasswordResetCollection().FindOne(ctx,
+		bson.M{"user_id": user.ID},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&latest)
+	if err == nil && now.Sub(latest.CreatedAt) < passwordResetCooldown {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Printf("❌ Failed to generate reset token for user %s: %v\n", user.ID.Hex(), err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	// token เก่าที่ยังไม่ได้ใช้ถือว่ายกเลิก เหลือแค่อันล่าสุด
+	if _, err := models.PasswordResetCollection().DeleteMany(ctx, bson.M{"user_id": user.ID, "used_at": bson.M{"$exists": false}}); err != nil {
+		log.Printf("⚠️ Failed to remove old reset tokens of user %s: %v\n", user.ID.Hex(), err)
+	}
+	if _, err := models.PasswordResetCollection().InsertOne(ctx, models.PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: now.Add(passwordResetValidFor),
+		CreatedAt: now,
+	}); err != nil {
+		log.Printf("❌ Failed to save reset token for user %s: %v\n", user.ID.Hex(), err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// ลิงก์ไปหน้าตั้งรหัสผ่านใหม่ของ frontend (ถ้าตั้งค่า FRONTEND_URL)
+	var link string
+	if frontend := os.Getenv("FRONTEND_URL"); frontend != "" {
+		link = strings.TrimRight(frontend, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	}
+	if err := utils.SendPasswordResetEmail(user.Gmail, token, link, int(passwordResetValidFor.Minutes())); err != nil {
+		// ไม่บอก client ว่าส่งไม่สำเร็จ ไม่อย่างนั้นจะรู้ได้ว่าอีเมลนี้มีบัญชี
+		log.Printf("❌ Failed to send password reset email to user %s: %v\n", user.ID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ตั้งรหัสผ่านใหม่ด้วย token จากอีเมล แล้วยกเลิก session เดิมทั้งหมดของผู้ใช้
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token           string `json:"token" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+		ConfirmPassword string `json:"confirmPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if input.NewPassword != input.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password and confirmation do not match"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hashed, err := hashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// ใช้ token พร้อมกับเปลี่ยนรหัสผ่าน ถ้าเปลี่ยนไม่สำเร็จ token ยังไม่ถูกเผา
+	reset, err := models.ResetPasswordWithToken(ctx, hashResetToken(strings.TrimSpace(input.Token)), hashed)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset token is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to reset password: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	if _, err := models.RevokeUserSessions(ctx, reset.UserID); err != nil {
+		log.Printf("❌ Failed to revoke sessions for user %s: %v\n", reset.UserID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+}
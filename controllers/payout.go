@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"arttoy-hub/payments"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	maxPayoutAttempts = 5
+	payoutRetryBase   = 5 * time.Minute // รอ 5, 10, 20, 40 นาทีก่อน retry
+	payoutClaimLease  = 5 * time.Minute // กันไม่ให้ job สองตัวโอนรายการเดียวกันพร้อมกัน
+	reconcileWindow   = 30 * 24 * time.Hour
+)
+
+// job รอบโอนเงิน: รวมยอดคงเหลือใน wallet ของผู้ขายแต่ละคนเป็น payout หนึ่งรายการแล้วโอนออก
+// ผู้ขายที่ยังมี payout ค้าง (pending/failed) จะข้ามไปจนกว่ารายการเดิมจะจบ
+func RunSellerPayouts() {
+	if paymentProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	balances, err := models.SellerBalances(ctx)
+	if err != nil {
+		log.Printf("❌ Failed to calculate seller balances: %v", err)
+		return
+	}
+
+	open, err := models.PayoutCollection().Distinct(ctx, "seller_id", bson.M{
+		"status": bson.M{"$in": []string{models.PayoutPending, models.PayoutFailed}},
+	})
+	if err != nil {
+		log.Printf("❌ Failed to fetch open payouts: %v", err)
+		return
+	}
+	skip := map[primitive.ObjectID]bool{}
+	for _, id := range open {
+		if sellerID, ok := id.(primitive.ObjectID); ok {
+			skip[sellerID] = true
+		}
+	}
+
+	now := time.Now()
+	batchID := now.Format("20060102-150405")
+	var created int
+	for sellerID := range balances {
+		if skip[sellerID] {
+			continue
+		}
+		// หักยอดใน ledger พร้อมสร้าง payout รอบถัดไปจะไม่เห็นยอดนี้อีก
+		_, err := models.CreatePayout(ctx, models.Payout{
+			ID:            primitive.NewObjectID(),
+			SellerID:      sellerID,
+			BatchID:       batchID,
+			Status:        models.PayoutPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+		if err == models.ErrPayoutOpen || err == models.ErrNoPayoutBalance {
+			continue // job อื่นสร้างไปแล้ว หรือยอดถูกหักไประหว่างนี้
+		}
+		if err != nil {
+			log.Printf("❌ Failed to create payout for seller %s: %v", sellerID.Hex(), err)
+			continue
+		}
+		created++
+	}
+	if created > 0 {
+		log.Printf("💸 Payout batch %s created %d payouts", batchID, created)
+	}
+
+	RetryDuePayouts()
+}
+
+// โอนเงิน payout ที่ถึงเวลาโอน (รวมถึงรายการที่รอ retry)
+func RetryDuePayouts() {
+	if paymentProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cursor, err := models.PayoutCollection().Find(ctx, bson.M{
+		"status":          models.PayoutPending,
+		"next_attempt_at": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		log.Printf("❌ Failed to find due payouts: %v", err)
+		return
+	}
+	var due []models.Payout
+	if err := cursor.All(ctx, &due); err != nil {
+		log.Printf("❌ Failed to decode due payouts: %v", err)
+		return
+	}
+
+	for _, payout := range due {
+		if _, err := attemptPayout(ctx, payout.ID); err != nil {
+			log.Printf("❌ Payout %s to seller %s failed: %v", payout.ID.Hex(), payout.SellerID.Hex(), err)
+		}
+	}
+}
+
+// ล็อกรายการ payout แล้วสั่งโอน ถ้าล้มเหลวจะตั้งเวลา retry แบบ backoff
+// ครบ maxPayoutAttempts แล้วจะเปลี่ยนเป็น failed ให้ admin สั่งโอนใหม่
+func attemptPayout(ctx context.Context, payoutID primitive.ObjectID) (models.Payout, error) {
+	now := time.Now()
+	var payout models.Payout
+	err := models.PayoutCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": payoutID, "status": models.PayoutPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{
+			"$set": bson.M{"next_attempt_at": now.Add(payoutClaimLease)},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&payout)
+	if err != nil {
+		return payout, errors.New("payout is not due or already being processed")
+	}
+
+	transfer, err := transferPayout(ctx, payout)
+	if err != nil {
+		if payout.Attempts >= maxPayoutAttempts {
+			// ครบจำนวนครั้งแล้ว คืนยอดที่หักไว้กลับเข้า wallet ผู้ขาย
+			if failErr := models.FailPayout(ctx, payout, err.Error()); failErr != nil {
+				return payout, fmt.Errorf("%v (and failed to mark payout failed: %v)", err, failErr)
+			}
+			return payout, err
+		}
+		if _, updErr := models.PayoutCollection().UpdateByID(ctx, payout.ID, bson.M{"$set": bson.M{
+			"last_error":      err.Error(),
+			"next_attempt_at": now.Add(payoutRetryBase << (payout.Attempts - 1)),
+		}}); updErr != nil {
+			return payout, fmt.Errorf("%v (and failed to schedule retry: %v)", err, updErr)
+		}
+		return payout, err
+	}
+
+	payout.Status = models.PayoutPaid
+	payout.TransferID = transfer.ID
+	payout.PaidAt = time.Now()
+	payout.LastError = ""
+	if _, err := models.PayoutCollection().UpdateByID(ctx, payout.ID, bson.M{
+		"$set":   bson.M{"status": payout.Status, "transfer_id": payout.TransferID, "paid_at": payout.PaidAt},
+		"$unset": bson.M{"last_error": "", "next_attempt_at": "", "open": ""},
+	}); err != nil {
+		return payout, fmt.Errorf("transfer %s created but payout not updated: %v", transfer.ID, err)
+	}
+
+	// ยอดถูกหักไว้ตั้งแต่ตอนสร้าง payout แล้ว เหลือแค่ผูก transfer ID
+	if err := models.AttachPayoutTransfer(ctx, payout, transfer.ID); err != nil {
+		return payout, fmt.Errorf("transfer %s not attached to ledger: %v", transfer.ID, err)
+	}
+	return payout, nil
+}
+
+// โอนเงินไปยัง recipient ของผู้ขาย ใช้ ID ของ payout เป็น reference กันโอนซ้ำตอน retry
+func transferPayout(ctx context.Context, payout models.Payout) (*payments.Transfer, error) {
+	var seller models.User
+	err := db.OpenCollection("users").FindOne(ctx, bson.M{"_id": payout.SellerID}).Decode(&seller)
+	if err != nil || seller.SellerInfo == nil || seller.SellerInfo.RecipientID == "" {
+		return nil, errors.New("seller or recipient not found")
+	}
+
+	return paymentProvider.CreateTransfer(ctx, payments.TransferRequest{
+		Amount:      payout.Amount.Satang(),
+		RecipientID: seller.SellerInfo.RecipientID,
+		Reference:   models.PayoutTransferReference(payout),
+	})
+}
+
+// กระทบยอด payout ที่โอนแล้วกับรายการโอนของ Omise ย้อนหลัง reconcileWindow
+// รายการที่ไม่ตรงจะถูก flag ไว้ที่ payout และบันทึกใน payout_mismatches
+func ReconcilePayouts() {
+	if paymentProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	since := time.Now().Add(-reconcileWindow)
+	transfers, err := paymentProvider.ListTransfers(ctx, since)
+	if err != nil {
+		log.Printf("❌ Failed to list transfers: %v", err)
+		return
+	}
+	byID := map[string]payments.Transfer{}
+	for _, t := range transfers {
+		byID[t.ID] = t
+	}
+
+	cursor, err := models.PayoutCollection().Find(ctx, bson.M{
+		"status":  models.PayoutPaid,
+		"paid_at": bson.M{"$gte": since},
+	})
+	if err != nil {
+		log.Printf("❌ Failed to fetch paid payouts: %v", err)
+		return
+	}
+	var paid []models.Payout
+	if err := cursor.All(ctx, &paid); err != nil {
+		log.Printf("❌ Failed to decode paid payouts: %v", err)
+		return
+	}
+
+	var flagged int
+	for _, payout := range paid {
+		transfer, found := byID[payout.TransferID]
+		delete(byID, payout.TransferID)
+
+		mismatch := models.PayoutMismatch{PayoutID: payout.ID, TransferID: payout.TransferID, Expected: payout.Amount}
+		switch {
+		case !found:
+			mismatch.Kind = models.MismatchMissingTransfer
+		case models.Money(transfer.Amount) != payout.Amount:
+			mismatch.Kind = models.MismatchAmount
+			mismatch.Actual = models.Money(transfer.Amount)
+		case transfer.FailureMessage != "":
+			mismatch.Kind = models.MismatchTransferFailed
+			mismatch.Actual = models.Money(transfer.Amount)
+			mismatch.Detail = transfer.FailureMessage
+		}
+
+		set := bson.M{"reconciled_at": time.Now()}
+		if mismatch.Kind != "" {
+			set["mismatch"] = mismatch.Kind
+			flagged++
+			if err := models.RecordPayoutMismatch(ctx, mismatch); err != nil {
+				log.Printf("❌ Failed to record mismatch for payout %s: %v", payout.ID.Hex(), err)
+			}
+		}
+		models.PayoutCollection().UpdateByID(ctx, payout.ID, bson.M{"$set": set})
+	}
+
+	// รายการโอนที่เหลือต้องมี payout ในระบบ (อาจเก่ากว่าช่วงที่ตรวจ) ไม่อย่างนั้นถือว่าไม่รู้ที่มา
+	for _, transfer := range byID {
+		count, err := models.PayoutCollection().CountDocuments(ctx, bson.M{"transfer_id": transfer.ID})
+		if err != nil || count > 0 {
+			continue
+		}
+		mismatch := models.PayoutMismatch{
+			Kind:       models.MismatchUnknownTransfer,
+			TransferID: transfer.ID,
+			Actual:     models.Money(transfer.Amount),
+		}
+		// reference ตรงกับ payout ที่ยังไม่ถูกบันทึกว่าโอนแล้ว เช่น timeout ตอนรอคำตอบจาก Omise
+		if payoutID, err := models.PayoutIDFromReference(transfer.Reference); err == nil {
+			mismatch.PayoutID = payoutID
+			mismatch.Detail = fmt.Sprintf("transfer references payout %s", transfer.Reference)
+		}
+		flagged++
+		if err := models.RecordPayoutMismatch(ctx, mismatch); err != nil {
+			log.Printf("❌ Failed to record mismatch for transfer %s: %v", transfer.ID, err)
+		}
+	}
+
+	log.Printf("🔎 Reconciled %d payouts against %d transfers, %d mismatches", len(paid), len(transfers), flagged)
+}
+
+// รายการ payout สำหรับ admin กรองด้วย ?status=pending|paid|failed
+func GetPayouts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(200)
+	cursor, err := models.PayoutCollection().Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payouts"})
+		return
+	}
+	payouts := []models.Payout{}
+	if err := cursor.All(ctx, &payouts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse payouts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"payouts": payouts})
+}
+
+// รายการที่กระทบยอดไม่ตรงและยังไม่ได้แก้ไข
+func GetPayoutMismatches(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := models.PayoutMismatchCollection().Find(ctx, bson.M{"resolved": false}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mismatches"})
+		return
+	}
+	mismatches := []models.PayoutMismatch{}
+	if err := cursor.All(ctx, &mismatches); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse mismatches"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mismatches": mismatches})
+}
+
+// admin ตรวจสอบแล้ว ปิดรายการที่ไม่ตรง
+func ResolvePayoutMismatch(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mismatch ID"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := models.PayoutMismatchCollection().UpdateByID(ctx, objID, bson.M{"$set": bson.M{"resolved": true}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mismatch"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mismatch not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Mismatch resolved"})
+}
+
+// admin สั่งโอน payout ที่ล้มเหลวใหม่ทันที
+func RetryPayout(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payout ID"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// เริ่มรอบใหม่และหักยอดจาก wallet อีกครั้ง (ตอน failed คืนยอดไปแล้ว)
+	err = models.RequeuePayout(ctx, objID)
+	if err == models.ErrPayoutNotFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only failed payouts can be retried"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payout"})
+		return
+	}
+
+	payout, err := attemptPayout(ctx, objID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Payout failed, will be retried", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Payout transferred successfully", "payout": payout})
+}
@@ -10,8 +10,9 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"mime/multipart"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 	// "fmt"
 )
@@ -58,8 +59,8 @@ func AddProduct(c *gin.Context) {
 		return
 	}
 
-	priceValue, err := strconv.ParseFloat(price, 64)
-	if err != nil {
+	priceValue, err := models.ParseBaht(price)
+	if err != nil || priceValue <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price"})
 		return
 	}
@@ -77,7 +78,7 @@ func AddProduct(c *gin.Context) {
 		return
 	}
 
-	if !user.IsSeller || user.SellerInfo == nil || !user.SellerInfo.IsVerified {
+	if !user.HasRole(models.RoleSeller) || user.SellerInfo == nil || !user.SellerInfo.IsVerified {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Only verified sellers can post products"})
 		return
 	}
@@ -86,15 +87,18 @@ func AddProduct(c *gin.Context) {
 	product.SellerID = sellerObjID
 	product.IsSold = false
 
-	// รูปภาพ
+	// รูปภาพ: ไฟล์ใน multipart และ/หรือ upload_session_id ที่ finalize แล้ว (อัปโหลดตรงไปที่ storage)
+	uploadSessionID := c.PostForm("upload_session_id")
+	var files []*multipart.FileHeader
 	form, err := c.MultipartForm()
-	if err != nil {
+	if err != nil && uploadSessionID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form"})
 		return
 	}
-
-	files := form.File["product_image"]
-	if len(files) == 0 {
+	if form != nil {
+		files = form.File["product_image"]
+	}
+	if len(files) == 0 && uploadSessionID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No image files uploaded"})
 		return
 	}
@@ -107,19 +111,34 @@ func AddProduct(c *gin.Context) {
 		}
 		defer f.Close()
 
-		imageURL, err := UploadImageToGCS(f, file.Header.Get("Content-Type"), "product_images")
+		variant, err := UploadProductImage(f, "product_images")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image to GCS"})
+			respondUploadError(c, err)
 			return
 		}
 
-		product.ImageURLs = append(product.ImageURLs, imageURL)
+		product.ImageURLs = append(product.ImageURLs, variant.Original)
+		product.ImageVariants = append(product.ImageVariants, variant)
+	}
+	if uploadSessionID != "" {
+		images, err := attachUploadSession(uploadSessionID, sellerObjID)
+		if err != nil {
+			respondUploadSessionError(c, err)
+			return
+		}
+		for _, variant := range images {
+			product.ImageURLs = append(product.ImageURLs, variant.Original)
+			product.ImageVariants = append(product.ImageVariants, variant)
+		}
 	}
 
 	product.CreatedAt = time.Now()
 
 	newProduct, err := models.AddProduct(product)
 	if err != nil {
+		if uploadSessionID != "" {
+			detachUploadSession(uploadSessionID, sellerObjID)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -217,44 +236,78 @@ func GetProductByID(c *gin.Context) {
 }
 
 
+// แก้สินค้าแบบ PATCH ส่งมาเฉพาะ field ที่ต้องการเปลี่ยน รับได้ทั้ง JSON และ multipart form
+// เจ้าของสินค้าและสิทธิ์ตรวจแล้วใน middlewares.ProductOwnerOrAdmin
 func UpdateProduct(c *gin.Context) {
-	id := c.Param("id")
-
-	// Parse multipart form
-	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form"})
+	product := c.MustGet("product").(models.Product)
+	if product.Locked() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is sold or reserved and cannot be edited"})
 		return
 	}
 
-	// ดึงค่าจาก form
-	name := c.PostForm("name")
-	description := c.PostForm("description")
-	priceStr := c.PostForm("price")
-	category := c.PostForm("category")
-	model := c.PostForm("model")
-	color := c.PostForm("color")
-	size := c.PostForm("size")
-	existingImagesJSON := c.PostForm("existing_images")
+	var patch models.ProductPatch
+	var files []*multipart.FileHeader
+	var uploadSessionID string
+	if c.ContentType() == "application/json" {
+		var input struct {
+			models.ProductPatch
+			UploadSessionID string `json:"upload_session_id"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		patch = input.ProductPatch
+		uploadSessionID = input.UploadSessionID
+	} else {
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form"})
+			return
+		}
+		patch.Name = formField(c, "name")
+		patch.Description = formField(c, "description")
+		patch.Category = formField(c, "category")
+		patch.Model = formField(c, "model")
+		patch.Color = formField(c, "color")
+		patch.Size = formField(c, "size")
+		if priceStr := formField(c, "price"); priceStr != nil {
+			price, err := models.ParseBaht(*priceStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price"})
+				return
+			}
+			patch.Price = &price
+		}
+		// existing_images = รูปเดิมที่ต้องการเก็บไว้ (JSON array)
+		if existingImagesJSON := formField(c, "existing_images"); existingImagesJSON != nil {
+			var existingImages []string
+			if err := json.Unmarshal([]byte(*existingImagesJSON), &existingImages); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid existing_images"})
+				return
+			}
+			patch.ImageURLs = &existingImages
+		}
+		if c.Request.MultipartForm != nil {
+			files = c.Request.MultipartForm.File["product_image"]
+		}
+		uploadSessionID = c.PostForm("upload_session_id")
+	}
 
-	// แปลง price เป็น float
-	price, err := strconv.ParseFloat(priceStr, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price"})
+	if patch.Name != nil && strings.TrimSpace(*patch.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
 		return
 	}
-
-	// แปลง existing_images จาก JSON เป็น []string
-	var existingImages []string
-	if err := json.Unmarshal([]byte(existingImagesJSON), &existingImages); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid existing_images"})
+	if patch.Price != nil && *patch.Price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price"})
 		return
 	}
 
-	// รับไฟล์ใหม่ (product_image)
-	form, _ := c.MultipartForm()
-	files := form.File["product_image"]
-
-	var newImageURLs []string
+	// เก็บได้เฉพาะรูปที่เป็นของสินค้านี้อยู่แล้ว ไม่ให้ใส่ URL อื่นเข้ามาเอง
+	images := product.ImageURLs
+	if patch.ImageURLs != nil {
+		images = keepOwnImages(*patch.ImageURLs, product.ImageURLs)
+	}
+	variants := models.VariantsFor(images, product.ImageVariants)
 	for _, file := range files {
 		f, err := file.Open()
 		if err != nil {
@@ -264,73 +317,103 @@ func UpdateProduct(c *gin.Context) {
 		defer f.Close()
 
 		// อัปโหลดจริง
-		imageURL, err := UploadImageToGCS(f, file.Header.Get("Content-Type"), "product_images")
+		variant, err := UploadProductImage(f, "product_images")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image"})
+			respondUploadError(c, err)
 			return
 		}
-		newImageURLs = append(newImageURLs, imageURL)
+		images = append(images, variant.Original)
+		variants = append(variants, variant)
 	}
 
-	// รวมรูปทั้งหมด
-	allImages := append(existingImages, newImageURLs...)
+	// รูปที่อัปโหลดตรงไปที่ storage และ finalize แล้ว
+	if uploadSessionID != "" {
+		userObjID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		uploaded, err := attachUploadSession(uploadSessionID, userObjID)
+		if err != nil {
+			respondUploadSessionError(c, err)
+			return
+		}
+		for _, variant := range uploaded {
+			images = append(images, variant.Original)
+			variants = append(variants, variant)
+		}
+	}
+	if patch.ImageURLs != nil || len(files) > 0 || uploadSessionID != "" {
+		if len(images) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product must have at least one image"})
+			return
+		}
+		patch.ImageURLs = &images
+		patch.ImageVariants = &variants
+	}
 
-	// 🔥 ดึงสินค้าเดิมจาก DB เพื่อเอา seller_id เดิมกลับมา
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	objID, err := primitive.ObjectIDFromHex(id)
+	updated, err := models.PatchProduct(ctx, product.ID, patch)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		if uploadSessionID != "" {
+			userObjID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+			detachUploadSession(uploadSessionID, userObjID)
+		}
+		respondProductMutationError(c, err)
 		return
 	}
 
-	var oldProduct models.Product
-	err = db.OpenCollection("products").FindOne(ctx, bson.M{"_id": objID}).Decode(&oldProduct)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	c.JSON(http.StatusOK, updated)
+}
+
+// ลบสินค้า เฉพาะเจ้าของหรือ admin และสินค้าต้องยังไม่ขายหรือถูกจอง
+func DeleteProduct(c *gin.Context) {
+	product := c.MustGet("product").(models.Product)
+	if product.Locked() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is sold or reserved and cannot be deleted"})
 		return
 	}
 
-	// สร้าง struct ใหม่
-	updated := models.Product{
-		Name:        name,
-		Description: description,
-		Price:       price,
-		Category:    category,
-		Model:       model,
-		Color:       color,
-		Size:        size,
-		ImageURLs:   allImages,
-		SellerID:    oldProduct.SellerID, // ✅ ใส่ seller_id เดิมกลับเข้าไป
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := models.DeleteProduct(ctx, product.ID); err != nil {
+		respondProductMutationError(c, err)
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Product deleted"})
+}
 
-	// แก้ไขใน DB
-	product, err := models.UpdateProduct(id, updated)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-			return
-		}
+func respondProductMutationError(c *gin.Context, err error) {
+	switch err {
+	case mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	case models.ErrProductUnavailable:
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is sold or reserved"})
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
 	}
+}
 
-	c.JSON(http.StatusOK, product)
+// ค่าจาก form ถ้าส่งมา (nil = ไม่ได้ส่ง field นี้)
+func formField(c *gin.Context, key string) *string {
+	value, ok := c.GetPostForm(key)
+	if !ok {
+		return nil
+	}
+	return &value
 }
 
-func DeleteProduct(c *gin.Context) {
-	id := c.Param("id")
-	err := models.DeleteProduct(id)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-			return
+func keepOwnImages(requested, current []string) []string {
+	own := make(map[string]bool, len(current))
+	for _, url := range current {
+		own[url] = true
+	}
+	kept := []string{}
+	for _, url := range requested {
+		if own[url] {
+			kept = append(kept, url)
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted"})
+	return kept
 }
 
 func GetMyProducts(c *gin.Context) {
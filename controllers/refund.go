@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"arttoy-hub/payments"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ถ้า claim คืนเงินค้างนานเกินนี้ (เช่น server ล่มกลางทาง) ให้สั่งใหม่ได้
+const refundClaimTimeout = 2 * time.Minute
+
+// คืนเงินให้ผู้ซื้อของ order ที่ถูกปฏิเสธหรือยกเลิกหลังจ่ายเงินแล้ว
+// ถ้า Omise ล้มเหลวจะเก็บ refund_error ไว้ให้ admin สั่งคืนเงินใหม่ได้ภายหลัง
+func refundOrder(ctx context.Context, order models.Order, event models.OrderEvent) error {
+	if order.ChargeID == "" || order.PaidAt.IsZero() {
+		return nil // ยังไม่ได้จ่าย ไม่มีอะไรต้องคืน
+	}
+
+	// จอง order ก่อนเรียก Omise ให้มีผู้สั่งคืนเงินได้ทีละคน
+	orders := db.OpenCollection("orders")
+	var previous models.Order
+	err := orders.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":       order.ID,
+			"refund_id": bson.M{"$exists": false},
+			"$or": []bson.M{
+				{"refund_pending": bson.M{"$ne": true}},
+				{"refund_pending_at": bson.M{"$lt": time.Now().Add(-refundClaimTimeout)}},
+			},
+		},
+		bson.M{"$set": bson.M{"refund_pending": true, "refund_pending_at": time.Now()}},
+	).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return errRefundInProgress
+	}
+	if err != nil {
+		return err
+	}
+
+	// key เดียวกันทุกครั้งที่คืนเงิน order นี้ Omise จะไม่สร้าง refund ซ้ำ
+	reference := "refund_" + order.ID.Hex()
+
+	// เคยสั่งคืนแล้วแต่ไม่รู้ผล ดูจาก refund ของ charge ก่อนว่าคืนไปแล้วหรือยัง
+	var refund *payments.Refund
+	if previous.RefundPending || previous.RefundAttempts > 0 {
+		existing, err := paymentProvider.ListRefunds(ctx, order.ChargeID)
+		if err != nil {
+			log.Printf("❌ Failed to list refunds of charge %s: %v\n", order.ChargeID, err)
+			releaseRefundClaim(ctx, order.ID, err)
+			return err
+		}
+		for _, r := range existing {
+			if r.Reference == reference {
+				r := r
+				refund = &r
+				log.Printf("⚠️ Order %s already refunded with %s, recording it\n", order.ID.Hex(), r.ID)
+				break
+			}
+		}
+	}
+
+	if refund == nil {
+		refund, err = paymentProvider.CreateRefund(ctx, payments.RefundRequest{
+			ChargeID:  order.ChargeID,
+			Amount:    order.GrandTotal.Satang(),
+			Reference: reference,
+		})
+		if err != nil {
+			log.Printf("❌ Refund failed for order %s: %v\n", order.ID.Hex(), err)
+			releaseRefundClaim(ctx, order.ID, err)
+			return err
+		}
+	}
+
+	if err := models.RecordOrderRefund(ctx, order, refund.ID); err != nil {
+		// เงินคืนไปแล้วแต่ ledger ไม่ตรง ปลด claim พร้อม refund_error ให้ order ขึ้นในรายการรอคืนเงินของ admin
+		// สั่งใหม่จะเจอ refund เดิมจาก ListRefunds แล้วบันทึก ledger ต่อโดยไม่คืนเงินซ้ำ
+		log.Printf("❌ Failed to record refund %s in ledger: %v\n", refund.ID, err)
+		err = fmt.Errorf("refund %s created but not recorded in ledger: %w", refund.ID, err)
+		releaseRefundClaim(ctx, order.ID, err)
+		return err
+	}
+
+	_, err = models.TransitionOrder(ctx, order.ID, order.Status, models.OrderRefunded, event, bson.M{
+		"refund_id":      refund.ID,
+		"refunded_at":    time.Now(),
+		"refund_error":   "",
+		"refund_pending": false,
+	})
+	if err != nil {
+		// claim ยังค้างอยู่ รอบหน้าจะเจอ refund นี้จาก ListRefunds แล้วบันทึกต่อ
+		log.Printf("❌ Refund %s created but order %s not updated: %v\n", refund.ID, order.ID.Hex(), err)
+		return err
+	}
+	log.Printf("✅ Refunded order %s with %s\n", order.ID.Hex(), refund.ID)
+	return nil
+}
+
+var errRefundInProgress = errors.New("refund already in progress or completed")
+
+// คืนเงินไม่สำเร็จ ปลด claim และเก็บ error ไว้ให้ admin สั่งใหม่
+func releaseRefundClaim(ctx context.Context, orderID primitive.ObjectID, cause error) {
+	if _, err := db.OpenCollection("orders").UpdateByID(ctx, orderID, bson.M{
+		"$set": bson.M{"refund_error": cause.Error(), "refund_pending": false},
+		"$inc": bson.M{"refund_attempts": 1},
+	}); err != nil {
+		log.Printf("❌ Failed to release refund claim of order %s: %v\n", orderID.Hex(), err)
+	}
+}
+
+// ผู้ซื้อยกเลิก order ก่อนผู้ขายรับออเดอร์ ถ้าจ่ายเงินแล้วจะคืนเงินให้
+func CancelOrderByBuyer(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&input)
+	if input.Reason == "" {
+		input.Reason = "buyer cancelled order"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	order, err := models.GetOrderByID(objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.UserID != userObjID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to cancel this order"})
+		return
+	}
+	if !models.CanTransition(order.Status, models.OrderCancelled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order can only be cancelled before the seller accepts it"})
+		return
+	}
+
+	cancelled, err := models.TransitionOrder(ctx, objID, order.Status, models.OrderCancelled, models.OrderEvent{
+		Actor:   models.ActorBuyer,
+		ActorID: userObjID,
+		Reason:  input.Reason,
+	}, nil)
+	if err == models.ErrOrderStatusStale {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status has changed, please refresh"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		return
+	}
+
+	if err := models.RestockOrderProducts(ctx, cancelled); err != nil {
+		log.Printf("❌ Failed to restock products of order %s: %v\n", objID.Hex(), err)
+	}
+
+	if err := refundOrder(ctx, cancelled, models.OrderEvent{
+		Actor:  models.ActorSystem,
+		Reason: "refund after buyer cancellation",
+	}); err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Order cancelled, refund will be retried", "refund_error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully"})
+}
+
+// รายการ order ที่ต้องคืนเงินแต่ยังคืนไม่สำเร็จ (สำหรับ admin)
+func GetPendingRefunds(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := db.OpenCollection("orders").Find(ctx, bson.M{
+		"status":    bson.M{"$in": []string{models.OrderRejected, models.OrderCancelled, models.OrderExpired}},
+		"paid_at":   bson.M{"$exists": true},
+		"charge_id": bson.M{"$exists": true},
+		"refund_id": bson.M{"$exists": false},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	orders := []models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse orders"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+// admin สั่งคืนเงินใหม่สำหรับ order ที่คืนเงินไม่สำเร็จ
+func RetryOrderRefund(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	adminObjID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	order, err := models.GetOrderByID(objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if !models.CanTransition(order.Status, models.OrderRefunded) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only rejected, cancelled or expired orders can be refunded"})
+		return
+	}
+	if order.PaidAt.IsZero() || order.ChargeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order was never paid"})
+		return
+	}
+
+	if err := refundOrder(ctx, order, models.OrderEvent{
+		Actor:   models.ActorAdmin,
+		ActorID: adminObjID,
+		Reason:  "refund retried by admin",
+	}); err != nil {
+		if err == errRefundInProgress {
+			c.JSON(http.StatusConflict, gin.H{"error": "Refund is already in progress"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Refund failed", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order refunded successfully"})
+}
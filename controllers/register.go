@@ -5,20 +5,27 @@ import (
 	"arttoy-hub/models"
 	"arttoy-hub/utils"
 	"context"
-	"fmt"
-	"math/rand"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var otpStore = make(map[string]string)
-var tempUserStore = make(map[string]models.User)
+const (
+	otpValidFor        = 10 * time.Minute // อายุของ OTP แต่ละรหัส
+	otpMaxAttempts     = 5                // กรอกผิดได้กี่ครั้งก่อนถูกล็อก
+	otpLockout         = 15 * time.Minute
+	otpResendCooldown  = 60 * time.Second
+	pendingRegisterTTL = 1 * time.Hour // เก็บข้อมูลสมัครที่ยังไม่ยืนยันไว้นานเท่าไร
+)
 
 func hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
@@ -68,34 +75,159 @@ func RequestOTP(c *gin.Context) {
 		return
 	}
 
-	// สุ่ม OTP
-	rand.Seed(time.Now().UnixNano())
-	otp := fmt.Sprintf("%06d", rand.Intn(1000000))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	// เข้ารหัสรหัสผ่าน
-	hashed, _ := hashPassword(input.Password)
+	// กันขอ OTP ถี่เกินไป หรือขอใหม่เพื่อหลบการล็อก
+	now := time.Now()
+	if pending, err := models.FindPendingRegistration(ctx, input.Gmail); err == nil {
+		if wait := otpWait(pending, now); wait > 0 {
+			retryAfter(c, wait)
+			return
+		}
+	}
 
-	// เก็บ user ชั่วคราว
-	tempUser := models.User{
-		ID:          primitive.NewObjectID(),
-		Username:    input.Username,
-		Gmail:       input.Gmail,
-		Phonenumber: input.Phonenumber,
-		Password:    hashed,
-		LikedItems:  []string{},
+	otp, err := utils.GenerateOTP()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate OTP"})
+		return
+	}
+	otpHash, err := bcrypt.GenerateFromPassword([]byte(otp), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate OTP"})
+		return
+	}
+
+	// เข้ารหัสรหัสผ่าน
+	hashed, err := hashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
 	}
 
-	otpStore[input.Gmail] = otp
-	tempUserStore[input.Gmail] = tempUser
+	// เก็บผู้สมัครไว้ใน Mongo จนกว่าจะยืนยัน OTP (ขอใหม่จะทับข้อมูลเดิม)
+	_, err = models.PendingRegistrationCollection().ReplaceOne(ctx,
+		bson.M{"gmail": input.Gmail},
+		models.PendingRegistration{
+			Gmail:        input.Gmail,
+			Username:     input.Username,
+			Phonenumber:  input.Phonenumber,
+			Password:     hashed,
+			OTPHash:      string(otpHash),
+			OTPExpiresAt: now.Add(otpValidFor),
+			LastSentAt:   now,
+			CreatedAt:    now,
+			PurgeAt:      now.Add(pendingRegisterTTL),
+		},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save registration"})
+		return
+	}
 
 	// ส่งอีเมล OTP
 	if err := utils.SendEmail(input.Gmail, otp); err != nil {
+		// ส่งไม่สำเร็จ ให้ขอใหม่ได้ทันทีโดยไม่ต้องรอ cooldown
+		models.PendingRegistrationCollection().UpdateOne(ctx, bson.M{"gmail": input.Gmail}, bson.M{"$unset": bson.M{"last_sent_at": ""}})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OTP sent to email", "expires_in": int(otpValidFor.Seconds())})
+}
+
+// ขอส่ง OTP ใหม่สำหรับผู้สมัครที่ยังไม่ยืนยัน (ต้องรอ cooldown และต้องไม่ถูกล็อก)
+func ResendOTP(c *gin.Context) {
+	var input struct {
+		Gmail string `json:"gmail" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	pending, err := models.FindPendingRegistration(ctx, input.Gmail)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending registration, please register again"})
+		return
+	}
+	if wait := otpWait(pending, now); wait > 0 {
+		retryAfter(c, wait)
+		return
+	}
+
+	otp, err := utils.GenerateOTP()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate OTP"})
+		return
+	}
+	otpHash, err := bcrypt.GenerateFromPassword([]byte(otp), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate OTP"})
+		return
+	}
+
+	// อัปเดตแบบมีเงื่อนไข กันสอง request ส่ง OTP พร้อมกัน
+	filter := bson.M{"_id": pending.ID, "last_sent_at": pending.LastSentAt}
+	if pending.LastSentAt.IsZero() {
+		filter["last_sent_at"] = bson.M{"$exists": false}
+	}
+	result, err := models.PendingRegistrationCollection().UpdateOne(ctx,
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"otp_hash":       string(otpHash),
+				"otp_expires_at": now.Add(otpValidFor),
+				"attempts":       0,
+				"last_sent_at":   now,
+				"purge_at":       now.Add(pendingRegisterTTL),
+			},
+			"$unset": bson.M{"locked_until": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update registration"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		retryAfter(c, otpResendCooldown)
+		return
+	}
+
+	if err := utils.SendEmail(input.Gmail, otp); err != nil {
+		models.PendingRegistrationCollection().UpdateByID(ctx, pending.ID, bson.M{"$unset": bson.M{"last_sent_at": ""}})
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "OTP sent to email"})
+	c.JSON(http.StatusOK, gin.H{"message": "OTP resent to email", "expires_in": int(otpValidFor.Seconds())})
+}
+
+// เวลาที่ต้องรอก่อนส่ง OTP ใหม่ได้ (ติดล็อกหรือยังไม่พ้น cooldown)
+func otpWait(pending models.PendingRegistration, now time.Time) time.Duration {
+	if pending.LockedUntil.After(now) {
+		return pending.LockedUntil.Sub(now)
+	}
+	if !pending.LastSentAt.IsZero() {
+		if wait := pending.LastSentAt.Add(otpResendCooldown).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// ตอบ 429 พร้อม header Retry-After (วินาที)
+func retryAfter(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later", "retry_after": seconds})
 }
+
 func VerifyOTP(c *gin.Context) {
 	type VerifyInput struct {
 		Gmail string `json:"gmail" binding:"required,email"`
@@ -108,22 +240,98 @@ func VerifyOTP(c *gin.Context) {
 		return
 	}
 
-	expectedOTP := otpStore[input.Gmail]
-	if expectedOTP != input.OTP {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect OTP"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	pending, err := models.FindPendingRegistration(ctx, input.Gmail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "OTP expired or not requested"})
+		return
+	}
+	if pending.LockedUntil.After(now) {
+		retryAfter(c, pending.LockedUntil.Sub(now))
+		return
+	}
+	if now.After(pending.OTPExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "OTP expired, please request a new one"})
+		return
+	}
+
+	// จองสิทธิ์หนึ่งครั้งก่อนเทียบรหัส request ที่ยิงพร้อมกันจึงเดาได้ไม่เกิน otpMaxAttempts
+	reserved, err := models.ReserveOTPAttempt(ctx, pending, otpMaxAttempts, now)
+	if err == mongo.ErrNoDocuments {
+		latest, err := models.FindPendingRegistration(ctx, input.Gmail)
+		switch {
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "OTP expired or not requested"})
+		case latest.LockedUntil.After(now):
+			retryAfter(c, latest.LockedUntil.Sub(now))
+		case latest.OTPHash != pending.OTPHash:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "OTP was replaced, please use the latest one"})
+		default:
+			retryAfter(c, otpLockout)
+		}
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify OTP"})
 		return
 	}
 
-	user := tempUserStore[input.Gmail]
-	userCollection := db.Client.Database("arttoyhub_db").Collection("users")
-	result, err := userCollection.InsertOne(context.Background(), user)
+	if bcrypt.CompareHashAndPassword([]byte(pending.OTPHash), []byte(input.OTP)) != nil {
+		// ครบจำนวนครั้งแล้วล็อกไว้ระยะหนึ่ง
+		if reserved.Attempts >= otpMaxAttempts {
+			if err := models.LockPendingRegistration(ctx, pending.ID, now.Add(otpLockout)); err != nil {
+				log.Printf("❌ Failed to lock OTP for %s: %v\n", pending.Gmail, err)
+			}
+			retryAfter(c, otpLockout)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":              "Incorrect OTP",
+			"attempts_remaining": otpMaxAttempts - reserved.Attempts,
+		})
+		return
+	}
+
+	// ลบก่อนสร้าง user เพื่อให้ OTP ใช้ได้ครั้งเดียว (request ที่ลบไม่ได้แปลว่ามีคนใช้ไปแล้ว)
+	deleted, err := models.PendingRegistrationCollection().DeleteOne(ctx, bson.M{"_id": pending.ID})
+	if err != nil || deleted.DeletedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "OTP expired or not requested"})
+		return
+	}
+
+	// ระหว่างรอ OTP อาจมีคนอื่นสมัครด้วยข้อมูลเดียวกันไปแล้ว
+	userCollection := db.OpenCollection("users")
+	count, err := userCollection.CountDocuments(ctx, bson.M{"$or": []bson.M{
+		{"username": pending.Username},
+		{"gmail": pending.Gmail},
+		{"phonenumber": pending.Phonenumber},
+	}})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register"})
 		return
 	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username, email or phone number already exists"})
+		return
+	}
 
-	delete(otpStore, input.Gmail)
-	delete(tempUserStore, input.Gmail)
+	user := models.User{
+		ID:          primitive.NewObjectID(),
+		Username:    pending.Username,
+		Gmail:       pending.Gmail,
+		Phonenumber: pending.Phonenumber,
+		Password:    pending.Password,
+		LikedItems:  []string{},
+		Roles:       []string{models.RoleBuyer},
+	}
+	result, err := userCollection.InsertOne(ctx, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Register successful", "user_id": result.InsertedID})
 }
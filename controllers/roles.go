@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"arttoy-hub/models"
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// admin เพิ่มบทบาทให้ผู้ใช้ มีผลเมื่อผู้ใช้ refresh token ครั้งถัดไป
+func GrantUserRole(c *gin.Context) {
+	userObjID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || !models.ValidRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role", "roles": models.AllRoles})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := models.GrantRole(ctx, userObjID, input.Role); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+	log.Printf("✅ Admin %s granted role %s to user %s\n", c.GetString("user_id"), input.Role, userObjID.Hex())
+	respondUserRoles(ctx, c, userObjID)
+}
+
+// admin ถอนบทบาท แล้วยกเลิก session ของผู้ใช้นั้น เพื่อไม่ให้ token ที่ยังมีบทบาทเดิมใช้ต่อได้
+func RevokeUserRole(c *gin.Context) {
+	userObjID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	role := c.Param("role")
+	if !models.ValidRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role", "roles": models.AllRoles})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// admin ต้องเหลืออย่างน้อยหนึ่งคนเสมอ ตรวจและถอนในคำสั่งเดียวกัน
+	if role == models.RoleAdmin {
+		err = models.RevokeAdminRole(ctx, userObjID)
+	} else {
+		err = models.RevokeRole(ctx, userObjID, role)
+	}
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+	if err := revokeAllSessions(ctx, userObjID); err != nil {
+		log.Printf("❌ Failed to revoke sessions for user %s: %v\n", userObjID.Hex(), err)
+	}
+	log.Printf("⚠️ Admin %s revoked role %s from user %s\n", c.GetString("user_id"), role, userObjID.Hex())
+	respondUserRoles(ctx, c, userObjID)
+}
+
+func respondRoleError(c *gin.Context, err error) {
+	switch err {
+	case models.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case models.ErrLastAdmin:
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot revoke the last admin"})
+	case models.ErrInvalidRole:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role", "roles": models.AllRoles})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update roles"})
+	}
+}
+
+func respondUserRoles(ctx context.Context, c *gin.Context, userID primitive.ObjectID) {
+	roles, err := models.UserRoles(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID.Hex(), "roles": roles})
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"arttoy-hub/authtoken"
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"arttoy-hub/utils"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	accessTokenTTL    = 15 * time.Minute
+	refreshTokenTTL   = 30 * 24 * time.Hour
+	refreshCookieName = "refresh_token"
+	refreshCookiePath = "/auth"
+)
+
+// สร้าง access token อายุสั้น ผูกกับ session ผ่าน claim "sid" และแนบบทบาทใน claim "roles"
+func generateAccessToken(userID, sessionID string, roles []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(accessTokenTTL)
+	signed, err := authtoken.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"sid":     sessionID,
+		"roles":   roles,
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+	return signed, expiresAt, err
+}
+
+func newRefreshToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// สร้าง session ใหม่หลัง login แล้วคืน access token และ refresh token
+func startSession(ctx context.Context, c *gin.Context, userID primitive.ObjectID, roles []string) (access string, accessExpiresAt time.Time, refresh string, err error) {
+	refresh, err = newRefreshToken()
+	if err != nil {
+		return
+	}
+	session, err := models.CreateSession(ctx, models.Session{
+		UserID:      userID,
+		RefreshHash: hashResetToken(refresh),
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		ExpiresAt:   time.Now().Add(refreshTokenTTL),
+	})
+	if err != nil {
+		return
+	}
+	access, accessExpiresAt, err = generateAccessToken(userID.Hex(), session.ID.Hex(), roles)
+	return
+}
+
+// ตั้ง cookie ของ access token, refresh token และ csrf token ตาม COOKIE_* ใน env คืน csrf token ให้ตอบกลับใน body ด้วย
+func setSessionCookies(c *gin.Context, access, refresh string) string {
+	utils.SetAuthCookie(c, "token", access, int(accessTokenTTL.Seconds()), "/")
+	utils.SetSecretCookie(c, refreshCookieName, refresh, int(refreshTokenTTL.Seconds()), refreshCookiePath)
+	csrf, err := utils.IssueCSRFCookie(c, int(refreshTokenTTL.Seconds()))
+	if err != nil {
+		log.Printf("❌ Failed to issue CSRF token: %v\n", err)
+	}
+	return csrf
+}
+
+// client ที่ไม่ใช้ cookie (mobile, script) ส่ง header X-Auth-Mode: bearer เพื่อรับ refresh token ใน body
+// browser ได้ refresh token ทาง cookie HttpOnly อย่างเดียว JavaScript บนหน้าเว็บจึงอ่านไม่ได้
+func bearerClient(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("X-Auth-Mode"), "bearer")
+}
+
+// ออก access token ใหม่ด้วย refresh token (จาก cookie หรือ body) และ rotate refresh token ทุกครั้ง
+func RefreshToken(c *gin.Context) {
+	refresh, _ := c.Cookie(refreshCookieName)
+	// ส่ง refresh token มาใน body แปลว่าไม่ได้ใช้ cookie ต้องได้ token ใหม่กลับไปใน body
+	fromBody := false
+	if refresh == "" {
+		var input struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		_ = c.ShouldBindJSON(&input)
+		refresh = input.RefreshToken
+		fromBody = refresh != ""
+	}
+	if refresh == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	next, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	session, err := models.RotateSession(ctx, hashResetToken(refresh), hashResetToken(next), time.Now().Add(refreshTokenTTL))
+	if err == models.ErrRefreshTokenReused {
+		log.Printf("⚠️ Refresh token reuse detected, session revoked (ip %s)\n", c.ClientIP())
+	}
+	if err != nil {
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please log in again"})
+		return
+	}
+
+	// อ่านบทบาทใหม่ทุกครั้ง บทบาทที่เพิ่ง grant/revoke จะมีผลภายในอายุ access token
+	roles, err := models.UserRoles(ctx, session.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	access, expiresAt, err := generateAccessToken(session.UserID.Hex(), session.ID.Hex(), roles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	csrf := setSessionCookies(c, access, next)
+	response := gin.H{
+		"token":      access,
+		"expires_at": expiresAt,
+		"csrf_token": csrf,
+	}
+	if fromBody || bearerClient(c) {
+		response["refresh_token"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ออก access token ใหม่ให้ session ปัจจุบันหลังบทบาทของผู้ใช้เปลี่ยน (เช่น สมัครเป็นผู้ขาย)
+func refreshAccessToken(ctx context.Context, c *gin.Context, userID primitive.ObjectID) {
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		return
+	}
+	roles, err := models.UserRoles(ctx, userID)
+	if err != nil {
+		return
+	}
+	access, _, err := generateAccessToken(userID.Hex(), sessionID, roles)
+	if err != nil {
+		return
+	}
+	utils.SetAuthCookie(c, "token", access, int(accessTokenTTL.Seconds()), "/")
+}
+
+// ออกจากระบบทุกอุปกรณ์: ยกเลิกทุก session และ token ที่ออกไปก่อนหน้านี้
+func LogoutAllDevices(c *gin.Context) {
+	userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := revokeAllSessions(ctx, userObjID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
+// ยกเลิก session ทั้งหมด รวมถึง token แบบเก่าที่ไม่มี session (ผ่าน sessions_revoked_at)
+func revokeAllSessions(ctx context.Context, userID primitive.ObjectID) error {
+	if _, err := models.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	_, err := db.OpenCollection("users").UpdateByID(ctx, userID, bson.M{"$set": bson.M{"sessions_revoked_at": time.Now()}})
+	return err
+}
+
+func clearAuthCookies(c *gin.Context) {
+	utils.ClearCookie(c, "token", "/")
+	utils.ClearCookie(c, refreshCookieName, refreshCookiePath)
+	utils.ClearCookie(c, utils.CSRFCookieName, "/")
+}
+
+// ขอ csrf token ใหม่ (เช่น cookie หาย) ต้อง login อยู่แล้ว ค่าที่ได้ส่งกลับใน header X-CSRF-Token
+func GetCSRFToken(c *gin.Context) {
+	csrf, err := utils.IssueCSRFCookie(c, int(refreshTokenTTL.Seconds()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"csrf_token": csrf})
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"arttoy-hub/models"
+	"arttoy-hub/utils"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+	recoveryCodeCount         = 10
+)
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Arttoy Hub"
+}
+
+// ผู้ใช้ที่เปิด 2FA: รหัสผ่านถูกแล้ว ออก challenge token ให้ไปยืนยันรหัส TOTP ต่อ ยังไม่สร้าง session
+func startTwoFactorChallenge(ctx context.Context, c *gin.Context, user models.User) {
+	token, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	now := time.Now()
+	challenge := models.LoginChallenge{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: now.Add(loginChallengeTTL),
+		CreatedAt: now,
+	}
+	if _, err := models.LoginChallengeCollection().InsertOne(ctx, challenge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_at":          challenge.ExpiresAt,
+	})
+}
+
+// ขั้นที่สองของ login: ส่ง challenge_token พร้อม code จากแอป หรือ recovery_code
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	challenge, err := models.FindLoginChallenge(ctx, hashResetToken(input.ChallengeToken))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge is invalid or has expired, please log in again"})
+		return
+	}
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": challenge.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := verifySecondFactor(ctx, user, input.Code, input.RecoveryCode); err != nil {
+		if err := models.FailLoginChallenge(ctx, challenge.ID, loginChallengeMaxAttempts); err != nil {
+			log.Printf("❌ Failed to record 2FA attempt for user %s: %v\n", user.ID.Hex(), err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+	if ok, err := models.ConsumeLoginChallenge(ctx, challenge.ID); err != nil || !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge is invalid or has expired, please log in again"})
+		return
+	}
+
+	completeLogin(ctx, c, user)
+}
+
+func verifySecondFactor(ctx context.Context, user models.User, code, recoveryCode string) error {
+	if code != "" {
+		return models.VerifyTOTP(ctx, user, code)
+	}
+	err := models.UseRecoveryCode(ctx, user.ID, hashResetToken(utils.NormalizeRecoveryCode(recoveryCode)))
+	if err == nil {
+		log.Printf("⚠️ Recovery code used by user %s\n", user.ID.Hex())
+	}
+	return err
+}
+
+// เริ่มตั้งค่า 2FA: สร้าง secret ใหม่ (ยังไม่เปิดใช้) และคืน URI ให้ frontend ทำเป็น QR
+func SetupTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if _, err := collection.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"two_factor.pending_secret": secret}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	account := user.Gmail
+	if account == "" {
+		account = user.Phonenumber
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPProvisioningURI(secret, totpIssuer(), account),
+	})
+}
+
+// ยืนยันรหัสแรกจากแอปแล้วเปิดใช้ 2FA คืน recovery code ให้ผู้ใช้เก็บ (แสดงครั้งเดียว)
+func EnableTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TwoFactor == nil || user.TwoFactor.PendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+	step, valid := utils.MatchTOTP(user.TwoFactor.PendingSecret, input.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	twoFactor := models.TwoFactor{
+		Enabled:       true,
+		Secret:        user.TwoFactor.PendingSecret,
+		RecoveryCodes: hashes,
+		LastUsedStep:  step,
+		EnabledAt:     time.Now(),
+	}
+	if _, err := collection.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"two_factor": twoFactor}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	log.Printf("✅ Two-factor authentication enabled for user %s\n", user.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// ปิด 2FA ต้องยืนยันทั้งรหัสผ่านและรหัส TOTP (หรือ recovery code)
+func DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if !user.TwoFactorEnabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !checkPasswordHash(input.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect password"})
+		return
+	}
+	if err := verifySecondFactor(ctx, user, input.Code, input.RecoveryCode); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if _, err := collection.UpdateByID(ctx, user.ID, bson.M{"$unset": bson.M{"two_factor": ""}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	log.Printf("⚠️ Two-factor authentication disabled for user %s\n", user.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// สร้าง recovery code ชุดใหม่ ชุดเดิมใช้ไม่ได้อีก
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if err := models.VerifyTOTP(ctx, user, input.Code); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if _, err := collection.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"two_factor.recovery_codes": hashes}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashResetToken(strings.ToLower(code))
+	}
+	return codes, hashes, nil
+}
+
+// ผู้ใช้ที่ login อยู่ ถ้าหาไม่เจอจะตอบ error ให้แล้ว
+func currentUser(ctx context.Context, c *gin.Context) (models.User, bool) {
+	var user models.User
+	userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return user, false
+	}
+	if err := collection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "arttoy-hub/imaging"
+    "arttoy-hub/models"
+    "arttoy-hub/storage"
+)
+
+// ขนาดรูปย่อของสินค้า (ด้านยาวสุด px)
+const (
+    thumbnailSize = 320
+    mediumSize    = 1024
+)
+
+// ที่เก็บไฟล์ (GCS หรือดิสก์ในเครื่อง) ตั้งค่าจาก main ผ่าน InitStorage
+// privateStore ใช้เก็บเอกสารส่วนตัว เช่นรูปบัตรประชาชน ไม่มี URL สาธารณะ
+var (
+    objectStore  storage.ObjectStore
+    privateStore storage.ObjectStore
+)
+
+func InitStorage(store, private storage.ObjectStore) {
+    objectStore = store
+    privateStore = private
+}
+
+// ชื่อไฟล์ไม่ซ้ำใน folder ใช้ UUID + Nano timestamp (ยังไม่มีนามสกุล)
+func newObjectBase(folder string) string {
+    return fmt.Sprintf("%s/%s_%d", folder, uuid.NewString(), time.Now().UnixNano())
+}
+
+func putEncoded(ctx context.Context, store storage.ObjectStore, key string, file imaging.Encoded) (string, error) {
+    if store == nil {
+        return "", fmt.Errorf("storage is not configured")
+    }
+    url, err := store.Put(ctx, key, bytes.NewReader(file.Data), file.ContentType)
+    if err != nil {
+        log.Printf("❌ Failed to upload %s: %v", key, err)
+        return "", fmt.Errorf("ไม่สามารถอัปโหลดไฟล์: %w", err)
+    }
+    return url, nil
+}
+
+// อัปโหลดรูปภาพ (โปรไฟล์ บัตรประชาชน ฯลฯ) ไปไว้ใน folder แล้วคืน URL
+// ตรวจชนิดไฟล์จริงและขนาด แล้วเข้ารหัสใหม่เพื่อตัด EXIF (เช่นพิกัด GPS) ออก
+func UploadImage(reader io.Reader, folder string) (string, error) {
+    img, err := imaging.Decode(reader)
+    if err != nil {
+        return "", err
+    }
+    original, err := img.Sanitized()
+    if err != nil {
+        return "", err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    url, err := putEncoded(ctx, objectStore, newObjectBase(folder)+"."+original.Ext, original)
+    if err != nil {
+        return "", err
+    }
+    log.Printf("File uploaded successfully: %s", url)
+    return url, nil
+}
+
+// อัปโหลดรูปเอกสารส่วนตัวไป private storage คืน key (ไม่มี URL สาธารณะ เปิดดูผ่าน SignedURL)
+func UploadPrivateImage(reader io.Reader, folder string) (string, error) {
+    img, err := imaging.Decode(reader)
+    if err != nil {
+        return "", err
+    }
+    original, err := img.Sanitized()
+    if err != nil {
+        return "", err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    key := newObjectBase(folder) + "." + original.Ext
+    if _, err := putEncoded(ctx, privateStore, key, original); err != nil {
+        return "", err
+    }
+    return key, nil
+}
+
+// อัปโหลดรูปสินค้าพร้อมรูปย่อ thumbnail, medium และ WebP
+func UploadProductImage(reader io.Reader, folder string) (models.ImageVariant, error) {
+    img, err := imaging.Decode(reader)
+    if err != nil {
+        return models.ImageVariant{}, err
+    }
+    original, err := img.Sanitized()
+    if err != nil {
+        return models.ImageVariant{}, err
+    }
+    thumbnail, err := img.Thumbnail(thumbnailSize, 80)
+    if err != nil {
+        return models.ImageVariant{}, err
+    }
+    medium, err := img.Thumbnail(mediumSize, 85)
+    if err != nil {
+        return models.ImageVariant{}, err
+    }
+    webp, err := img.WebP(mediumSize)
+    if err != nil {
+        return models.ImageVariant{}, err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+    defer cancel()
+
+    base := newObjectBase(folder)
+    var variant models.ImageVariant
+    for _, item := range []struct {
+        key  string
+        file imaging.Encoded
+        url  *string
+    }{
+        {base + "." + original.Ext, original, &variant.Original},
+        {base + "_thumb." + thumbnail.Ext, thumbnail, &variant.Thumbnail},
+        {base + "_medium." + medium.Ext, medium, &variant.Medium},
+        {base + "_medium." + webp.Ext, webp, &variant.WebP},
+    } {
+        if *item.url, err = putEncoded(ctx, objectStore, item.key, item.file); err != nil {
+            return models.ImageVariant{}, err
+        }
+    }
+    log.Printf("File uploaded successfully: %s", variant.Original)
+    return variant, nil
+}
+
+// ตอบ error ของการอัปโหลด รูปไม่ผ่านการตรวจตอบ 400/413 นอกนั้น 500
+func respondUploadError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, imaging.ErrTooLarge):
+        c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image file is too large"})
+    case errors.Is(err, imaging.ErrUnsupportedType):
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Only JPEG, PNG, GIF or WebP images are allowed"})
+    case errors.Is(err, imaging.ErrTooManyPixels):
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Image dimensions are too large"})
+    case errors.Is(err, imaging.ErrCorrupt):
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image file"})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image"})
+    }
+}
@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/imaging"
+	"arttoy-hub/models"
+	"arttoy-hub/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxUploadSlots      = 10
+	uploadURLTTL        = 15 * time.Minute // อายุ URL สำหรับ PUT
+	uploadSessionTTL    = time.Hour        // ต้อง finalize ภายในเวลานี้
+	finalizedSessionTTL = 24 * time.Hour   // รูปที่ finalize แล้วรอผูกกับสินค้าใหม่ได้นานเท่านี้
+	uploadStagingFolder = "upload_staging" // ไฟล์ที่ยังไม่ finalize ถ้าค้างจะถูกลบโดย image sweeper
+)
+
+var (
+	errUploadNotFound   = errors.New("uploaded object not found")
+	errInvalidUploadKey = errors.New("key does not belong to this upload session")
+)
+
+// ขอช่องอัปโหลดรูปสินค้า ได้ URL แบบ signed สำหรับ PUT ไฟล์ตรงไปที่ storage ไม่ต้องผ่าน API
+// POST /api/uploads/sessions {"count": 3}
+func CreateUploadSession(c *gin.Context) {
+	userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var input struct {
+		Count int `json:"count" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Count < 1 || input.Count > maxUploadSlots {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count must be between 1 and %d", maxUploadSlots)})
+		return
+	}
+	if objectStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage is not configured"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session := models.UploadSession{
+		ID:        primitive.NewObjectID(),
+		UserID:    userObjID,
+		ExpiresAt: time.Now().Add(uploadSessionTTL),
+	}
+	type slot struct {
+		Key       string            `json:"key"`
+		UploadURL string            `json:"upload_url"`
+		Method    string            `json:"method"`
+		Headers   map[string]string `json:"headers"` // client ต้องส่ง header เหล่านี้มากับ PUT
+		ExpiresAt time.Time         `json:"expires_at"`
+	}
+	slots := make([]slot, 0, input.Count)
+	urlExpiresAt := time.Now().Add(uploadURLTTL)
+	for i := 0; i < input.Count; i++ {
+		key := fmt.Sprintf("%s/%s/%s/%d_%s", uploadStagingFolder, userObjID.Hex(), session.ID.Hex(), i, uuid.NewString())
+		// จำกัดขนาดตั้งแต่ตอน PUT ไม่ให้ไฟล์ใหญ่เกินไปค้างใน bucket ระหว่างรอ finalize
+		url, headers, err := objectStore.SignedUploadURL(ctx, key, imaging.MaxBytes(), uploadURLTTL)
+		if err != nil {
+			log.Printf("❌ Failed to sign upload URL: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload URL"})
+			return
+		}
+		session.Keys = append(session.Keys, key)
+		slots = append(slots, slot{Key: key, UploadURL: url, Method: http.MethodPut, Headers: headers, ExpiresAt: urlExpiresAt})
+	}
+
+	if _, err := models.CreateUploadSession(ctx, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload session"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"session_id": session.ID.Hex(),
+		"expires_at": session.ExpiresAt,
+		"max_bytes":  imaging.MaxBytes(),
+		"slots":      slots,
+	})
+}
+
+// ตรวจไฟล์ที่ client อัปโหลดเสร็จแล้ว (มีจริง ขนาดไม่เกิน เป็นรูปจริง) สร้าง variant แล้วผูกกับสินค้า
+// POST /api/uploads/sessions/:id/finalize {"keys": [...], "product_id": "..."}
+// ไม่ส่ง product_id = เก็บไว้ใช้ตอนสร้างสินค้าใหม่ด้วย upload_session_id
+func FinalizeUploadSession(c *gin.Context) {
+	userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+	var input struct {
+		Keys      []string `json:"keys" binding:"required"`
+		ProductID string   `json:"product_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || len(input.Keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keys are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// สินค้าที่จะผูกต้องเป็นของผู้ใช้เอง (หรือเป็น admin) และยังแก้ไขได้
+	var product models.Product
+	if input.ProductID != "" {
+		productID, err := primitive.ObjectIDFromHex(input.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+		if err := db.ProductCollection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if product.SellerID != userObjID && !models.HasRole(c.GetStringSlice("roles"), models.RoleAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only modify your own products"})
+			return
+		}
+		if product.Locked() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Product is sold or reserved and cannot be edited"})
+			return
+		}
+	}
+
+	session, err := models.ClaimUploadSession(ctx, sessionID, userObjID)
+	if err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+	images, err := ingestUploadSession(ctx, session, input.Keys)
+	if err != nil {
+		// ctx อาจหมดเวลาไปแล้วระหว่างประมวลผลรูป ใช้ context ใหม่คืน session
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if releaseErr := models.ReleaseUploadSession(releaseCtx, sessionID, userObjID); releaseErr != nil {
+			log.Printf("⚠️ Failed to release upload session %s: %v", sessionID.Hex(), releaseErr)
+		}
+		releaseCancel()
+		if errors.Is(err, errUploadNotFound) || errors.Is(err, errInvalidUploadKey) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondUploadError(c, err)
+		return
+	}
+
+	// เก็บผลไว้ใน session ก่อน ถ้าผูกกับสินค้าไม่สำเร็จยังใช้ upload_session_id กับ PATCH สินค้าได้
+	if err := models.CompleteUploadSession(ctx, sessionID, userObjID, images, finalizedSessionTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize upload session"})
+		return
+	}
+	if product.ID.IsZero() {
+		c.JSON(http.StatusOK, gin.H{"session_id": sessionID.Hex(), "images": images})
+		return
+	}
+
+	if _, err := models.AttachUploadSession(ctx, sessionID, userObjID); err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+	updated, err := models.AppendProductImages(ctx, product.ID, images)
+	if err != nil {
+		detachUploadSession(sessionID.Hex(), userObjID)
+		respondProductMutationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// ตรวจและย้ายไฟล์ทุก key ของ session ไปเป็นรูปสินค้า เรียงตามที่ client ส่งมา
+func ingestUploadSession(ctx context.Context, session models.UploadSession, keys []string) ([]models.ImageVariant, error) {
+	allowed := map[string]bool{}
+	for _, key := range session.Keys {
+		allowed[key] = true
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if !allowed[key] || seen[key] {
+			return nil, fmt.Errorf("%w: %s", errInvalidUploadKey, key)
+		}
+		seen[key] = true
+	}
+
+	images := make([]models.ImageVariant, 0, len(keys))
+	for _, key := range keys {
+		variant, err := ingestStagedImage(ctx, objectStore, key)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, variant)
+	}
+	// ลบไฟล์ต้นฉบับเมื่อผ่านครบทุกไฟล์แล้ว ถ้ามีไฟล์ไม่ผ่าน client ยังแก้แล้ว finalize ใหม่ได้
+	for _, key := range keys {
+		if err := objectStore.Delete(ctx, key); err != nil {
+			log.Printf("⚠️ Failed to delete staged upload %s: %v", key, err)
+		}
+	}
+	return images, nil
+}
+
+// ตรวจไฟล์ที่ client อัปโหลดตรง ผ่าน pipeline เดียวกับการอัปโหลดผ่าน API
+func ingestStagedImage(ctx context.Context, store storage.ObjectStore, key string) (models.ImageVariant, error) {
+	info, err := store.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.ImageVariant{}, fmt.Errorf("%w: %s", errUploadNotFound, key)
+	}
+	if err != nil {
+		return models.ImageVariant{}, err
+	}
+	// ตรวจขนาดก่อนดาวน์โหลด
+	if info.Size > imaging.MaxBytes() {
+		return models.ImageVariant{}, imaging.ErrTooLarge
+	}
+
+	reader, err := store.Open(ctx, key)
+	if err != nil {
+		return models.ImageVariant{}, err
+	}
+	defer reader.Close()
+	return UploadProductImage(reader, "product_images")
+}
+
+// ใช้รูปของ upload session ที่ finalize แล้วกับ AddProduct/UpdateProduct ใช้ได้ครั้งเดียว
+func attachUploadSession(sessionIDHex string, userID primitive.ObjectID) ([]models.ImageVariant, error) {
+	sessionID, err := primitive.ObjectIDFromHex(sessionIDHex)
+	if err != nil {
+		return nil, models.ErrUploadSessionNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	session, err := models.AttachUploadSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return session.Images, nil
+}
+
+// บันทึกสินค้าไม่สำเร็จหลัง attach แล้ว คืน session ให้ใช้ upload_session_id เดิมได้อีก
+func detachUploadSession(sessionIDHex string, userID primitive.ObjectID) {
+	sessionID, err := primitive.ObjectIDFromHex(sessionIDHex)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := models.DetachUploadSession(ctx, sessionID, userID); err != nil {
+		log.Printf("⚠️ Failed to release upload session %s: %v", sessionIDHex, err)
+	}
+}
+
+func respondUploadSessionError(c *gin.Context, err error) {
+	switch err {
+	case models.ErrUploadSessionNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found or expired"})
+	case models.ErrUploadSessionState:
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload session was already finalized or is being processed"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load upload session"})
+	}
+}
@@ -35,20 +35,14 @@ func UpdateProfile(c *gin.Context) {
 	}
 
 	var profileImageURL string
-	file, header, err := c.Request.FormFile("profile_image")
+	file, _, err := c.Request.FormFile("profile_image")
 	if err == nil {
 		defer file.Close()
 
-		// อ่าน content type
-		contentType := header.Header.Get("Content-Type")
-		if contentType == "" {
-			contentType = "image/jpeg"
-		}
-
-		// อัปโหลดไป GCS
-		profileImageURL, err = UploadImageToGCS(file, contentType, "profile")
+		// อัปโหลดรูป (ตรวจชนิดไฟล์จริงและตัด EXIF)
+		profileImageURL, err = UploadImage(file, "profile")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload image: %v", err)})
+			respondUploadError(c, err)
 			return
 		}
 	}
@@ -95,6 +89,7 @@ func GetProfile(c *gin.Context) {
 	}
 
 	user.Password = "" // ไม่คืน password กลับ
+	user.TwoFactorOn = user.TwoFactorEnabled()
 	c.JSON(http.StatusOK, user)
 }
 func contains(slice []string, item string) bool {
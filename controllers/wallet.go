@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"arttoy-hub/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"time"
+)
+
+// ยอดเงินคงเหลือและประวัติใน wallet ของผู้ขายที่ login อยู่
+func GetMyWallet(c *gin.Context) {
+	sellerObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	account := models.SellerAccount(sellerObjID)
+	balance, err := models.AccountBalance(ctx, account)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate balance"})
+		return
+	}
+	history, err := models.AccountHistory(ctx, account, 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet history"})
+		return
+	}
+
+	// รอบโอนเงินออกล่าสุด
+	cursor, err := models.PayoutCollection().Find(ctx, bson.M{"seller_id": sellerObjID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(20))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payouts"})
+		return
+	}
+	payouts := []models.Payout{}
+	if err := cursor.All(ctx, &payouts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse payouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"balance":  balance,
+		"currency": models.Currency,
+		"history":  history,
+		"payouts":  payouts,
+	})
+}
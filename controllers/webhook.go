@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"arttoy-hub/payments"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/omise/omise-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// รับ event จาก Omise แล้วอัปเดตสถานะการชำระเงินของ order
+// เชื่อแค่ ID ของ charge ใน payload สถานะจริงดึงจาก Omise ใหม่ทุกครั้ง
+func OmiseWebhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+
+	secret := os.Getenv("OMISE_WEBHOOK_SECRET")
+	if secret == "" {
+		log.Println("❌ Omise webhook rejected: OMISE_WEBHOOK_SECRET is not set")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhook is not configured"})
+		return
+	}
+	if !verifyOmiseSignature(c.Request, body, secret, time.Now()) {
+		log.Println("❌ Omise webhook signature mismatch")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var event omise.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		log.Printf("❌ Failed to parse Omise event: %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event payload"})
+		return
+	}
+	log.Printf("📩 Omise event %s key=%s\n", event.ID, event.Key)
+
+	// สนใจเฉพาะ event ของ charge ที่เกี่ยวกับการจ่ายเงิน
+	if event.Key != "charge.complete" && event.Key != "charge.expire" {
+		c.JSON(http.StatusOK, gin.H{"message": "Event ignored"})
+		return
+	}
+
+	payload, ok := event.Data.(*omise.Charge)
+	if !ok || payload == nil || payload.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event data is not a charge"})
+		return
+	}
+	if paymentProvider == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payment provider is not configured"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	charge, err := paymentProvider.RetrieveCharge(ctx, payload.ID)
+	if err == payments.ErrChargeNotFound {
+		log.Printf("⚠️ Omise event %s for unknown charge %s\n", event.ID, payload.ID)
+		c.JSON(http.StatusOK, gin.H{"message": "Charge not found, ignored"})
+		return
+	}
+	if err != nil {
+		// ตอบ 5xx ให้ Omise ส่ง event นี้มาใหม่ภายหลัง
+		log.Printf("❌ Failed to retrieve charge %s: %v\n", payload.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to retrieve charge"})
+		return
+	}
+
+	// หา order ย่อยทั้งหมดของ charge นี้จาก charge_id หรือ source_id
+	filter := bson.M{"charge_id": charge.ID}
+	if charge.SourceID != "" {
+		filter = bson.M{"$or": []bson.M{
+			{"charge_id": charge.ID},
+			{"source_id": charge.SourceID},
+		}}
+	}
+
+	orderEvent := models.OrderEvent{
+		Actor:  models.ActorOmise,
+		Reason: event.Key + " (" + event.ID + ")",
+	}
+
+	var changed int
+	switch charge.Status {
+	case payments.ChargeSuccessful:
+		changed, err = markChargePaid(ctx, filter, orderEvent)
+	case payments.ChargeExpired, payments.ChargeFailed, payments.ChargeReversed:
+		changed, err = markChargeExpired(ctx, filter, orderEvent)
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Charge still pending"})
+		return
+	}
+	// charge ที่ไม่ใช่ของระบบเรา ตอบ 200 เพื่อให้ Omise เลิกส่งซ้ำ
+	if err == errNoChargeOrders {
+		log.Printf("⚠️ No order for charge %s\n", charge.ID)
+		c.JSON(http.StatusOK, gin.H{"message": "No order for charge, ignored"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to apply event %s to charge %s: %v\n", event.ID, charge.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+
+	// event ซ้ำจะไม่เปลี่ยนอะไร แต่ต้องตอบ 200 เพื่อไม่ให้ Omise ส่งซ้ำอีก
+	if changed == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Event already processed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order updated", "orders_updated": changed})
+}
+
+var errNoChargeOrders = errors.New("no order for charge")
+
+type chargeOrder struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	CheckoutID primitive.ObjectID `bson:"checkout_id"`
+}
+
+// order ย่อยทั้งหมดที่จ่ายด้วย charge เดียวกัน
+func findChargeOrders(ctx context.Context, filter bson.M) ([]chargeOrder, error) {
+	cursor, err := db.OpenCollection("orders").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var orders []chargeOrder
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errNoChargeOrders
+	}
+	return orders, nil
+}
+
+// charge จ่ายสำเร็จ: อัปเดตทุก order ย่อยเป็น pending และ checkout เป็น paid
+// order ย่อยที่ถูกยกเลิกหรือหมดอายุไปก่อนจะคืนเงินส่วนของ order นั้นอัตโนมัติ
+// คืนจำนวน order ที่เปลี่ยนสถานะ (0 = event ซ้ำ)
+func markChargePaid(ctx context.Context, filter bson.M, event models.OrderEvent) (int, error) {
+	orders, err := findChargeOrders(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var changed int
+	for _, order := range orders {
+		ok, err := markOrderPaid(ctx, order.ID, event)
+		if err == nil && !ok {
+			err = refundLatePayment(ctx, order.ID)
+		}
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, models.SetCheckoutStatus(ctx, orders[0].CheckoutID, models.CheckoutPaid)
+}
+
+// charge หมดอายุหรือล้มเหลว: ทุก order ย่อยที่ยังรอจ่ายเป็น expired
+func markChargeExpired(ctx context.Context, filter bson.M, event models.OrderEvent) (int, error) {
+	orders, err := findChargeOrders(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var changed int
+	for _, order := range orders {
+		ok, err := markOrderExpired(ctx, order.ID, event)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, models.SetCheckoutStatus(ctx, orders[0].CheckoutID, models.CheckoutExpired)
+}
+
+// อัปเดต order ที่รอจ่ายเงินให้เป็น pending บันทึกเงินเข้า escrow และตั้ง is_sold ให้สินค้า
+// คืนค่า false ถ้า order ไม่ได้อยู่ในสถานะ waiting_payment แล้ว (เช่น event ซ้ำ)
+func markOrderPaid(ctx context.Context, orderID primitive.ObjectID, event models.OrderEvent) (bool, error) {
+	order, sold, err := models.PayOrder(ctx, orderID, event)
+	if err == models.ErrOrderStatusStale {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if sold < int64(len(order.Items)) {
+		log.Printf("⚠️ Order %s paid but only %d/%d products could be marked sold\n", order.ID.Hex(), sold, len(order.Items))
+	}
+	return true, nil
+}
+
+// อัปเดต order ที่รอจ่ายเงินให้เป็น expired
+func markOrderExpired(ctx context.Context, orderID primitive.ObjectID, event models.OrderEvent) (bool, error) {
+	_, err := models.TransitionOrder(ctx, orderID, models.OrderWaitingPayment, models.OrderExpired, event, nil)
+	if err == models.ErrOrderStatusStale {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, models.ReleaseReservations(ctx, orderID)
+}
+
+// ผู้ซื้อจ่ายเงินเข้ามาหลัง order ถูกยกเลิกหรือหมดอายุแล้ว ต้องคืนเงินอัตโนมัติ
+func refundLatePayment(ctx context.Context, orderID primitive.ObjectID) error {
+	order, err := models.GetOrderByID(orderID)
+	if err != nil {
+		return err
+	}
+	if order.RefundID != "" || (order.Status != models.OrderCancelled && order.Status != models.OrderExpired) {
+		return nil
+	}
+
+	if order.PaidAt.IsZero() {
+		order.PaidAt = time.Now()
+		if _, err := db.OpenCollection("orders").UpdateByID(ctx, orderID, bson.M{
+			"$set": bson.M{"paid_at": order.PaidAt},
+		}); err != nil {
+			return err
+		}
+	}
+	if err := models.RecordOrderPayment(ctx, order); err != nil {
+		return err
+	}
+	log.Printf("⚠️ Late payment for %s order %s, refunding\n", order.Status, orderID.Hex())
+	return refundOrder(ctx, order, models.OrderEvent{
+		Actor:  models.ActorSystem,
+		Reason: "payment received after order was " + order.Status,
+	})
+}
+
+// event ที่เก่ากว่านี้ถือว่าเป็นการส่งซ้ำ (replay) ไม่รับ
+const omiseSignatureTolerance = 5 * time.Minute
+
+// ตรวจลายเซ็น Omise-Signature และ Omise-Signature-Timestamp ต้องไม่เก่าหรือล้ำหน้าเกิน tolerance
+func verifyOmiseSignature(r *http.Request, body []byte, secret string, now time.Time) bool {
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		key = []byte(secret)
+	}
+
+	timestamp := r.Header.Get("Omise-Signature-Timestamp")
+	header := r.Header.Get("Omise-Signature")
+	if timestamp == "" || header == "" {
+		return false
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > omiseSignatureTolerance || age < -omiseSignatureTolerance {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp + "." + string(body)))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	// ช่วงหมุน secret Omise จะส่งมาหลายลายเซ็นคั่นด้วย comma
+	for _, sig := range strings.Split(header, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(sig)), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
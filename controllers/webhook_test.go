@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"arttoy-hub/payments"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const testWebhookSecret = "whsec_test_secret"
+
+// อ่าน event ที่บันทึกไว้จาก Omise (test mode)
+func loadOmiseEvent(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile("testdata/omise/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func signOmise(body []byte, secret string, at time.Time) (timestamp, signature string) {
+	timestamp = strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	return timestamp, hex.EncodeToString(mac.Sum(nil))
+}
+
+func replayOmiseEvent(body []byte, timestamp, signature string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/webhook", OmiseWebhook)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if timestamp != "" {
+		req.Header.Set("Omise-Signature-Timestamp", timestamp)
+		req.Header.Set("Omise-Signature", signature)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func useFakeProvider(t *testing.T) *payments.FakeProvider {
+	t.Helper()
+	fake := payments.NewFake()
+	previous := paymentProvider
+	InitPayments(fake)
+	t.Cleanup(func() { InitPayments(previous) })
+	return fake
+}
+
+func TestOmiseWebhookRequiresSecret(t *testing.T) {
+	t.Setenv("OMISE_WEBHOOK_SECRET", "")
+	useFakeProvider(t)
+
+	w := replayOmiseEvent(loadOmiseEvent(t, "charge_complete.json"), "", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestOmiseWebhookRejectsInvalidSignature(t *testing.T) {
+	t.Setenv("OMISE_WEBHOOK_SECRET", testWebhookSecret)
+	useFakeProvider(t)
+	body := loadOmiseEvent(t, "charge_complete.json")
+
+	cases := map[string]func() (string, string, []byte){
+		"missing headers": func() (string, string, []byte) { return "", "", body },
+		"wrong secret": func() (string, string, []byte) {
+			ts, sig := signOmise(body, "other_secret", time.Now())
+			return ts, sig, body
+		},
+		"tampered body": func() (string, string, []byte) {
+			ts, sig := signOmise(body, testWebhookSecret, time.Now())
+			return ts, sig, bytes.Replace(body, []byte(`"amount": 125000`), []byte(`"amount": 1`), 1)
+		},
+		"stale timestamp": func() (string, string, []byte) {
+			ts, sig := signOmise(body, testWebhookSecret, time.Now().Add(-time.Hour))
+			return ts, sig, body
+		},
+		"future timestamp": func() (string, string, []byte) {
+			ts, sig := signOmise(body, testWebhookSecret, time.Now().Add(time.Hour))
+			return ts, sig, body
+		},
+	}
+	for name, build := range cases {
+		t.Run(name, func(t *testing.T) {
+			ts, sig, payload := build()
+			if w := replayOmiseEvent(payload, ts, sig); w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestOmiseWebhookIgnoresOtherEvents(t *testing.T) {
+	t.Setenv("OMISE_WEBHOOK_SECRET", testWebhookSecret)
+	useFakeProvider(t)
+	body := loadOmiseEvent(t, "transfer_create.json")
+
+	ts, sig := signOmise(body, testWebhookSecret, time.Now())
+	w := replayOmiseEvent(body, ts, sig)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Event ignored") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+// payload บอกว่าจ่ายแล้ว แต่ charge จริงที่ provider ยัง pending ต้องไม่ถือว่าจ่าย
+func TestOmiseWebhookUsesProviderChargeStatus(t *testing.T) {
+	t.Setenv("OMISE_WEBHOOK_SECRET", testWebhookSecret)
+	fake := useFakeProvider(t)
+	fake.Charges["chrg_test_5xyz0p9o8i7u6y5t4r3"] = &payments.Charge{
+		ID:       "chrg_test_5xyz0p9o8i7u6y5t4r3",
+		SourceID: "src_test_5xyz0p8n4v2c1x9z8a7",
+		Amount:   125000,
+		Status:   payments.ChargePending,
+	}
+	body := loadOmiseEvent(t, "charge_complete.json")
+
+	ts, sig := signOmise(body, testWebhookSecret, time.Now())
+	w := replayOmiseEvent(body, ts, sig)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Charge still pending") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+// charge ที่ provider ไม่รู้จัก ตอบ 200 เพื่อให้ Omise เลิกส่งซ้ำ
+func TestOmiseWebhookUnknownCharge(t *testing.T) {
+	t.Setenv("OMISE_WEBHOOK_SECRET", testWebhookSecret)
+	useFakeProvider(t)
+	body := loadOmiseEvent(t, "charge_complete.json")
+
+	ts, sig := signOmise(body, testWebhookSecret, time.Now())
+	w := replayOmiseEvent(body, ts, sig)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+// charge และ source ใน testdata/omise/charge_complete.json
+const (
+	testChargeID = "chrg_test_5xyz0p9o8i7u6y5t4r3"
+	testSourceID = "src_test_5xyz0p8n4v2c1x9z8a7"
+)
+
+// ต่อ MongoDB สำหรับเทสต์ ใช้ database แยกแล้วลบทิ้งเมื่อจบ ถ้าไม่ได้ตั้ง MONGODB_TEST_URI จะข้าม
+// ต้องเป็น replica set เพราะการจ่ายเงินใช้ transaction
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	previousClient, previousName, previousProducts := db.Client, db.DatabaseName, db.ProductCollection
+	db.Client = client
+	db.DatabaseName = "arttoyhub_test_" + primitive.NewObjectID().Hex()
+	db.ProductCollection = db.OpenCollection("products")
+	t.Cleanup(func() {
+		client.Database(db.DatabaseName).Drop(context.Background())
+		db.Client, db.DatabaseName, db.ProductCollection = previousClient, previousName, previousProducts
+		client.Disconnect(context.Background())
+	})
+	if err := models.EnsureLedgerIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// order รอจ่ายเงินที่จองสินค้าไว้หนึ่งชิ้น ผูกกับ charge ใน event ที่บันทึกไว้
+func insertWaitingOrder(t *testing.T) (models.Order, primitive.ObjectID) {
+	t.Helper()
+	ctx := context.Background()
+	orderID, productID := primitive.NewObjectID(), primitive.NewObjectID()
+	if _, err := db.ProductCollection.InsertOne(ctx, bson.M{
+		"_id":            productID,
+		"name":           "Labubu",
+		"is_sold":        false,
+		"reserved_by":    orderID,
+		"reserved_until": time.Now().Add(15 * time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	order, err := models.CreateOrderCtx(ctx, models.Order{
+		ID:         orderID,
+		UserID:     primitive.NewObjectID(),
+		SellerID:   primitive.NewObjectID(),
+		CheckoutID: primitive.NewObjectID(),
+		Items:      []models.OrderItem{{ProductID: productID, Price: models.Money(125000), Quantity: 1}},
+		Total:      models.Money(125000),
+		GrandTotal: models.Money(125000),
+		ChargeID:   testChargeID,
+		SourceID:   testSourceID,
+		Status:     models.OrderWaitingPayment,
+		ExpiredAt:  time.Now().Add(15 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order, productID
+}
+
+func countLedger(t *testing.T, key string) int64 {
+	t.Helper()
+	n, err := db.OpenCollection("ledger").CountDocuments(context.Background(), bson.M{"key": key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func deliverChargeComplete(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+	body := loadOmiseEvent(t, "charge_complete.json")
+	ts, sig := signOmise(body, testWebhookSecret, time.Now())
+	w := replayOmiseEvent(body, ts, sig)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	return w
+}
+
+// Omise ส่ง charge.complete ซ้ำ ต้องบันทึกเงินเข้า escrow ครั้งเดียวและตั้ง is_sold
+func TestOmiseWebhookChargeCompleteTwice(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("OMISE_WEBHOOK_SECRET", testWebhookSecret)
+	fake := useFakeProvider(t)
+	fake.Charges[testChargeID] = &payments.Charge{ID: testChargeID, SourceID: testSourceID, Amount: 125000, Status: payments.ChargeSuccessful}
+	order, productID := insertWaitingOrder(t)
+
+	if w := deliverChargeComplete(t); !strings.Contains(w.Body.String(), "Order updated") {
+		t.Fatalf("first delivery: %s", w.Body.String())
+	}
+	if w := deliverChargeComplete(t); !strings.Contains(w.Body.String(), "Event already processed") {
+		t.Fatalf("second delivery: %s", w.Body.String())
+	}
+
+	if n := countLedger(t, "payment:"+order.ID.Hex()); n != 1 {
+		t.Fatalf("payment ledger entries = %d, want 1", n)
+	}
+	paid, err := models.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paid.Status != models.OrderPending || paid.PaidAt.IsZero() {
+		t.Fatalf("order status = %s paid_at = %v, want pending and paid", paid.Status, paid.PaidAt)
+	}
+	var product struct {
+		IsSold     bool               `bson:"is_sold"`
+		ReservedBy primitive.ObjectID `bson:"reserved_by"`
+	}
+	if err := db.ProductCollection.FindOne(context.Background(), bson.M{"_id": productID}).Decode(&product); err != nil {
+		t.Fatal(err)
+	}
+	if !product.IsSold || !product.ReservedBy.IsZero() {
+		t.Fatalf("product is_sold = %v reserved_by = %s, want sold without reservation", product.IsSold, product.ReservedBy.Hex())
+	}
+	if len(fake.Refunds) != 0 {
+		t.Fatalf("refunds = %d, want 0", len(fake.Refunds))
+	}
+}
+
+// เงินเข้ามาหลัง order หมดอายุแล้ว ต้องคืนเงินครั้งเดียวและไม่ตั้ง is_sold
+func TestOmiseWebhookChargeCompleteAfterExpiry(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("OMISE_WEBHOOK_SECRET", testWebhookSecret)
+	fake := useFakeProvider(t)
+	fake.Charges[testChargeID] = &payments.Charge{ID: testChargeID, SourceID: testSourceID, Amount: 125000, Status: payments.ChargeSuccessful}
+	order, productID := insertWaitingOrder(t)
+
+	ctx := context.Background()
+	if ok, err := markOrderExpired(ctx, order.ID, models.OrderEvent{Actor: models.ActorSystem, Reason: "test expiry"}); err != nil || !ok {
+		t.Fatalf("expire order: ok = %v err = %v", ok, err)
+	}
+
+	deliverChargeComplete(t)
+	deliverChargeComplete(t)
+
+	refunded, err := models.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refunded.Status != models.OrderRefunded || refunded.RefundID == "" {
+		t.Fatalf("order status = %s refund_id = %q, want refunded", refunded.Status, refunded.RefundID)
+	}
+	if len(fake.Refunds) != 1 || fake.Refunds[0].Amount != 125000 {
+		t.Fatalf("refunds = %+v, want one refund of 125000", fake.Refunds)
+	}
+	if n := countLedger(t, "payment:"+order.ID.Hex()); n != 1 {
+		t.Fatalf("payment ledger entries = %d, want 1", n)
+	}
+	if n := countLedger(t, "refund:"+order.ID.Hex()); n != 1 {
+		t.Fatalf("refund ledger entries = %d, want 1", n)
+	}
+	var product struct {
+		IsSold bool `bson:"is_sold"`
+	}
+	if err := db.ProductCollection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		t.Fatal(err)
+	}
+	if product.IsSold {
+		t.Fatal("product of expired order was marked sold")
+	}
+}
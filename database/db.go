@@ -18,6 +18,9 @@ var CategoryCollection *mongo.Collection
 var UserCollection *mongo.Collection
 var ReviewCollection *mongo.Collection
 
+// DatabaseName ชื่อ database ที่ใช้ เทสต์เปลี่ยนเป็น database ชั่วคราวได้
+var DatabaseName = "arttoyhub_db"
+
 // InitDB เริ่มต้นการเชื่อมต่อ MongoDB
 func InitDB() {
 	mongoURI := os.Getenv("MONGODB_URI")
@@ -46,10 +49,10 @@ func InitDB() {
 
 	Client = client
 	// กำหนด ProductCollection (ปรับชื่อ database ตามที่คุณใช้ใน MongoDB Atlas)
-	ProductCollection = client.Database("arttoyhub_db").Collection("products")
-	CategoryCollection = client.Database("arttoyhub_db").Collection("categories")
-	UserCollection = client.Database("arttoyhub_db").Collection("users")
-	ReviewCollection = client.Database("arttoyhub_db").Collection("reviews")
+	ProductCollection = client.Database(DatabaseName).Collection("products")
+	CategoryCollection = client.Database(DatabaseName).Collection("categories")
+	UserCollection = client.Database(DatabaseName).Collection("users")
+	ReviewCollection = client.Database(DatabaseName).Collection("reviews")
 
 	log.Println("Connected to MongoDB Atlas!")
 }
@@ -73,5 +76,5 @@ func DisconnectDB() {
 
 // OpenCollection คืนค่าคอลเลกชันจากชื่อที่กำหนด
 func OpenCollection(collectionName string) *mongo.Collection {
-	return Client.Database("arttoyhub_db").Collection(collectionName)
+	return Client.Database(DatabaseName).Collection(collectionName)
 }
@@ -0,0 +1,191 @@
+// Package imaging ตรวจรูปที่อัปโหลด (ชนิดจริง ขนาดไฟล์ ขนาดภาพ) เข้ารหัสใหม่เพื่อตัด EXIF
+// และสร้างรูปย่อสำหรับหน้ารายการสินค้า
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrTooLarge        = errors.New("image file is too large")
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+	ErrCorrupt         = errors.New("image could not be decoded")
+)
+
+// ชนิดไฟล์ที่รับ ดูจาก byte จริงของไฟล์ ไม่เชื่อ Content-Type ที่ client ส่งมา
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type Config struct {
+	MaxBytes     int64 // ขนาดไฟล์สูงสุด
+	MaxDimension int   // ด้านยาวสุดของภาพ (px)
+	MaxPixels    int   // กว้าง x สูง สูงสุด กันภาพที่ decode แล้วกินหน่วยความจำมหาศาล
+}
+
+func DefaultConfig() Config {
+	return Config{MaxBytes: 10 << 20, MaxDimension: 6000, MaxPixels: 24_000_000}
+}
+
+var config = DefaultConfig()
+
+// LoadConfig อ่าน IMAGE_MAX_MB, IMAGE_MAX_DIMENSION และ IMAGE_MAX_PIXELS
+func LoadConfig() error {
+	cfg := DefaultConfig()
+	for _, item := range []struct {
+		env   string
+		apply func(n int64)
+	}{
+		{"IMAGE_MAX_MB", func(n int64) { cfg.MaxBytes = n << 20 }},
+		{"IMAGE_MAX_DIMENSION", func(n int64) { cfg.MaxDimension = int(n) }},
+		{"IMAGE_MAX_PIXELS", func(n int64) { cfg.MaxPixels = int(n) }},
+	} {
+		raw := os.Getenv(item.env)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s must be a positive integer", item.env)
+		}
+		item.apply(n)
+	}
+	config = cfg
+	return nil
+}
+
+// MaxBytes ขนาดไฟล์สูงสุดที่รับ ใช้ตรวจไฟล์ที่ client อัปโหลดตรงไปที่ storage ก่อนดาวน์โหลดมาเปิด
+func MaxBytes() int64 {
+	return config.MaxBytes
+}
+
+// Image รูปที่ตรวจแล้ว หมุนตาม EXIF orientation แล้ว
+type Image struct {
+	img    image.Image
+	Format string // jpeg, png, gif หรือ webp ตามไฟล์จริง
+}
+
+func (im *Image) Bounds() image.Rectangle {
+	return im.img.Bounds()
+}
+
+// Decode อ่านและตรวจรูปจาก r ไม่เกิน MaxBytes
+func Decode(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, config.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > config.MaxBytes {
+		return nil, ErrTooLarge
+	}
+	if !allowedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+
+	// ตรวจขนาดจาก header ก่อน decode จริง
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 ||
+		cfg.Width > config.MaxDimension || cfg.Height > config.MaxDimension ||
+		cfg.Width*cfg.Height > config.MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return &Image{img: img, Format: format}, nil
+}
+
+// Encoded ไฟล์ที่เข้ารหัสใหม่แล้ว (ไม่มี metadata เดิมติดมา)
+type Encoded struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// Sanitized เข้ารหัสรูปเต็มขนาดใหม่ JPEG คงเป็น JPEG ส่วนแบบอื่นเป็น PNG เพื่อเก็บความโปร่งใส
+// (GIF เคลื่อนไหวจะเหลือเฟรมแรก)
+func (im *Image) Sanitized() (Encoded, error) {
+	if im.Format == "jpeg" {
+		return encodeJPEG(im.img, 90)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, im.img); err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), ContentType: "image/png", Ext: "png"}, nil
+}
+
+// Thumbnail รูปย่อด้านยาวไม่เกิน maxSide เป็น JPEG (พื้นโปร่งใสจะเป็นสีขาว)
+func (im *Image) Thumbnail(maxSide, quality int) (Encoded, error) {
+	return encodeJPEG(flatten(Fit(im.img, maxSide)), quality)
+}
+
+// WebP รูปย่อด้านยาวไม่เกิน maxSide แบบ WebP (lossless)
+func (im *Image) WebP(maxSide int) (Encoded, error) {
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, Fit(im.img, maxSide), nil); err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), ContentType: "image/webp", Ext: "webp"}, nil
+}
+
+// Fit ย่อภาพให้ด้านยาวไม่เกิน maxSide ภาพที่เล็กกว่าอยู่แล้วคืนตามเดิม
+func Fit(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return src
+	}
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+func flatten(src image.Image) image.Image {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Over)
+	return dst
+}
+
+func encodeJPEG(img image.Image, quality int) (Encoded, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: "jpg"}, nil
+}
@@ -0,0 +1,310 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// เปลี่ยน config ชั่วคราว คืนค่าเดิมเมื่อจบ test
+func withConfig(t *testing.T, cfg Config) {
+	t.Helper()
+	old := config
+	config = cfg
+	t.Cleanup(func() { config = old })
+}
+
+// ภาพสองสี ครึ่งซ้ายแดง ครึ่งขวาน้ำเงิน
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{0, 0, 255, 255}
+			if x < w/2 {
+				c = color.NRGBA{255, 0, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeTestJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ใส่ APP1 EXIF (big-endian TIFF มีแค่ orientation) ต่อจาก SOI พร้อมข้อความที่ต้องหายไปหลัง sanitize
+func withEXIF(jpg []byte, orientation uint16, extra string) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)           // จำนวน entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)      // Orientation
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)           // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)           // count
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation) // value
+	tiff = append(tiff, 0, 0)
+	tiff = binary.BigEndian.AppendUint32(tiff, 0) // ไม่มี IFD ถัดไป
+	tiff = append(tiff, extra...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestDecodeSniffsRealType(t *testing.T) {
+	img := testImage(8, 6)
+	webp, err := (&Image{img: img, Format: "png"}).WebP(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name       string
+		data       []byte
+		wantFormat string
+		wantErr    error
+	}{
+		{"png", encodePNG(t, img), "png", nil},
+		{"jpeg", encodeTestJPEG(t, img), "jpeg", nil},
+		{"gif", encodeGIF(t, img), "gif", nil},
+		{"webp", webp.Data, "webp", nil},
+		{"empty", nil, "", ErrUnsupportedType},
+		{"plain text", []byte("definitely not an image"), "", ErrUnsupportedType},
+		{"html", []byte("<html><body><img src=x onerror=alert(1)></body></html>"), "", ErrUnsupportedType},
+		{"svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`), "", ErrUnsupportedType},
+		{"pdf", []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"), "", ErrUnsupportedType},
+		{"bmp", append([]byte("BM"), make([]byte, 64)...), "", ErrUnsupportedType},
+		{"truncated png", encodePNG(t, img)[:40], "", ErrCorrupt},
+		{"png magic only", []byte("\x89PNG\r\n\x1a\n"), "", ErrCorrupt},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Decode(bytes.NewReader(tc.data))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Format != tc.wantFormat {
+				t.Fatalf("format = %q, want %q", got.Format, tc.wantFormat)
+			}
+			if b := got.Bounds(); b.Dx() != 8 || b.Dy() != 6 {
+				t.Fatalf("bounds = %v, want 8x6", b)
+			}
+		})
+	}
+}
+
+func TestDecodeSizeCaps(t *testing.T) {
+	small := encodePNG(t, testImage(10, 10))
+	for _, tc := range []struct {
+		name    string
+		cfg     Config
+		data    []byte
+		wantErr error
+	}{
+		{"within limits", Config{MaxBytes: int64(len(small)), MaxDimension: 10, MaxPixels: 100}, small, nil},
+		{"one byte over MaxBytes", Config{MaxBytes: int64(len(small)) - 1, MaxDimension: 10, MaxPixels: 100}, small, ErrTooLarge},
+		{"width over MaxDimension", Config{MaxBytes: 1 << 20, MaxDimension: 9, MaxPixels: 100}, small, ErrTooManyPixels},
+		{"tall image over MaxDimension", Config{MaxBytes: 1 << 20, MaxDimension: 50, MaxPixels: 1 << 20}, encodePNG(t, testImage(2, 51)), ErrTooManyPixels},
+		{"area over MaxPixels", Config{MaxBytes: 1 << 20, MaxDimension: 10, MaxPixels: 99}, small, ErrTooManyPixels},
+		// ไฟล์เล็กแต่ header อ้างขนาดมหาศาล ต้องถูกปฏิเสธก่อน decode
+		{"huge header, tiny file", DefaultConfig(), encodePNG(t, image.NewGray(image.Rect(0, 0, 6001, 1))), ErrTooManyPixels},
+		{"under MaxPixels but 5000x5000", DefaultConfig(), pngHeader(t, 5000, 5000), ErrTooManyPixels},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withConfig(t, tc.cfg)
+			if _, err := Decode(bytes.NewReader(tc.data)); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// PNG ที่มีแค่ header บอกขนาด w x h (ไม่มีข้อมูลภาพ)
+func pngHeader(t *testing.T, w, h int) []byte {
+	t.Helper()
+	data := encodePNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+	header := append([]byte{}, data[:33]...)
+	binary.BigEndian.PutUint32(header[16:], uint32(w))
+	binary.BigEndian.PutUint32(header[20:], uint32(h))
+	// DecodeConfig ตรวจ CRC ของ IHDR ด้วย ต้องคำนวณใหม่
+	binary.BigEndian.PutUint32(header[29:], crc32.ChecksumIEEE(header[12:29]))
+	return header
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := encodeTestJPEG(t, testImage(8, 4))
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", jpg, 1},
+		{"rotate 90", withEXIF(jpg, 6, ""), 6},
+		{"rotate 180", withEXIF(jpg, 3, ""), 3},
+		{"mirror", withEXIF(jpg, 2, ""), 2},
+		{"out of range", withEXIF(jpg, 9, ""), 1},
+		{"zero", withEXIF(jpg, 0, ""), 1},
+		{"not a jpeg", []byte("hello"), 1},
+		{"empty", nil, 1},
+		{"truncated segment", withEXIF(jpg, 6, "")[:12], 1},
+	} {
+		if got := jpegOrientation(tc.data); got != tc.want {
+			t.Errorf("%s: jpegOrientation = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// รูปที่มี EXIF orientation ต้องถูกหมุนให้ถูกทิศ และไฟล์ที่เข้ารหัสใหม่ต้องไม่มี EXIF เดิมเหลือ
+func TestDecodeAppliesOrientationAndStripsEXIF(t *testing.T) {
+	const secret = "GPS 13.7563N 100.5018E"
+	data := withEXIF(encodeTestJPEG(t, testImage(16, 8)), 6, secret)
+	if !bytes.Contains(data, []byte(secret)) {
+		t.Fatal("test input does not contain the EXIF payload")
+	}
+
+	im, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := im.Bounds(); b.Dx() != 8 || b.Dy() != 16 {
+		t.Fatalf("bounds = %v, want 8x16 after rotating 90°", b)
+	}
+	// หมุนตามเข็ม 90° ครึ่งซ้าย (แดง) ต้องขึ้นไปอยู่ครึ่งบน
+	if r, _, b, _ := im.img.At(4, 3).RGBA(); r < b {
+		t.Errorf("top half is not red after rotation")
+	}
+	if r, _, b, _ := im.img.At(4, 12).RGBA(); b < r {
+		t.Errorf("bottom half is not blue after rotation")
+	}
+
+	for name, encode := range map[string]func() (Encoded, error){
+		"sanitized": im.Sanitized,
+		"thumbnail": func() (Encoded, error) { return im.Thumbnail(4, 80) },
+		"webp":      func() (Encoded, error) { return im.WebP(4) },
+	} {
+		out, err := encode()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if bytes.Contains(out.Data, []byte("Exif")) || bytes.Contains(out.Data, []byte(secret)) {
+			t.Errorf("%s output still carries EXIF metadata", name)
+		}
+		if got := jpegOrientation(out.Data); got != 1 {
+			t.Errorf("%s output orientation = %d, want 1", name, got)
+		}
+	}
+}
+
+func TestSanitizedFormat(t *testing.T) {
+	img := testImage(8, 6)
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		contentType string
+		ext         string
+	}{
+		{"jpeg stays jpeg", encodeTestJPEG(t, img), "image/jpeg", "jpg"},
+		{"png stays png", encodePNG(t, img), "image/png", "png"},
+		{"gif becomes png", encodeGIF(t, img), "image/png", "png"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			im, err := Decode(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := im.Sanitized()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.ContentType != tc.contentType || out.Ext != tc.ext {
+				t.Fatalf("Sanitized = %s/%s, want %s/%s", out.ContentType, out.Ext, tc.contentType, tc.ext)
+			}
+			// ผลลัพธ์ต้องเปิดผ่าน Decode ได้อีกครั้ง
+			if _, err := Decode(bytes.NewReader(out.Data)); err != nil {
+				t.Fatalf("re-decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	for _, tc := range []struct {
+		w, h, maxSide int
+		wantW, wantH  int
+	}{
+		{100, 50, 200, 100, 50}, // เล็กกว่าอยู่แล้ว
+		{100, 50, 100, 100, 50},
+		{400, 200, 100, 100, 50},
+		{200, 400, 100, 50, 100},
+		{300, 300, 120, 120, 120},
+		{1000, 1, 100, 100, 1}, // ด้านสั้นไม่ต่ำกว่า 1
+	} {
+		b := Fit(image.NewNRGBA(image.Rect(0, 0, tc.w, tc.h)), tc.maxSide).Bounds()
+		if b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+			t.Errorf("Fit(%dx%d, %d) = %dx%d, want %dx%d", tc.w, tc.h, tc.maxSide, b.Dx(), b.Dy(), tc.wantW, tc.wantH)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Cleanup(func() { config = DefaultConfig() })
+
+	t.Setenv("IMAGE_MAX_MB", "2")
+	t.Setenv("IMAGE_MAX_DIMENSION", "4000")
+	t.Setenv("IMAGE_MAX_PIXELS", "")
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	want := Config{MaxBytes: 2 << 20, MaxDimension: 4000, MaxPixels: DefaultConfig().MaxPixels}
+	if config != want {
+		t.Fatalf("config = %+v, want %+v", config, want)
+	}
+	if MaxBytes() != 2<<20 {
+		t.Fatalf("MaxBytes = %d", MaxBytes())
+	}
+
+	for _, bad := range []string{"0", "-1", "ten", "1.5"} {
+		t.Setenv("IMAGE_MAX_MB", bad)
+		if err := LoadConfig(); err == nil {
+			t.Errorf("LoadConfig accepted IMAGE_MAX_MB=%q", bad)
+		}
+		if config != want {
+			t.Errorf("invalid IMAGE_MAX_MB=%q changed config to %+v", bad, config)
+		}
+	}
+}
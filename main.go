@@ -1,15 +1,25 @@
 package main
 
 import (
+	"arttoy-hub/authtoken"
 	"arttoy-hub/controllers"
 	"arttoy-hub/database"
 	"arttoy-hub/gcs"
+	"arttoy-hub/imaging"
+	"arttoy-hub/middleware"
+	"arttoy-hub/models"
+	"arttoy-hub/payments"
+	"arttoy-hub/ratelimit"
 	"arttoy-hub/routes"
+	"arttoy-hub/storage"
+	"arttoy-hub/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
 	"github.com/joho/godotenv"
+	"context"
 	"log"
 	"os"
+	"strings"
 )
 
 
@@ -20,17 +30,25 @@ func main() {
 		_ = godotenv.Load()
 	}
 
-	// อ่าน path ไฟล์ credential จริงจาก env
-	credentialPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
-	if credentialPath == "" {
-		log.Fatal("GOOGLE_APPLICATION_CREDENTIALS env variable is missing")
+	// โหลดค่าธรรมเนียมแพลตฟอร์ม
+	if err := models.LoadFeeConfig(); err != nil {
+		log.Fatalf("ตั้งค่าค่าธรรมเนียมไม่ถูกต้อง: %v", err)
 	}
 
-	// เรียก InitGCSFromFile แทน
-	if err := gcs.InitGCSFromFile(credentialPath); err != nil {
-		log.Fatalf("ไม่สามารถเชื่อมต่อ Google Cloud Storage: %v", err)
+	// key สำหรับเซ็น JWT ถ้าไม่ได้ตั้งไว้จะไม่ยอมเริ่ม server
+	if err := authtoken.Init(); err != nil {
+		log.Fatalf("ตั้งค่า JWT key ไม่ถูกต้อง: %v", err)
+	}
+
+	// ตั้งค่า cookie (domain, Secure, SameSite, HttpOnly)
+	if err := utils.LoadCookieConfig(); err != nil {
+		log.Fatalf("ตั้งค่า cookie ไม่ถูกต้อง: %v", err)
+	}
+
+	// ขนาดไฟล์/ขนาดภาพสูงสุดของรูปที่อัปโหลด
+	if err := imaging.LoadConfig(); err != nil {
+		log.Fatalf("ตั้งค่ารูปภาพไม่ถูกต้อง: %v", err)
 	}
-	defer gcs.Close()
 
 	// เริ่มเชื่อมต่อ MongoDB
 	db.InitDB()
@@ -38,13 +56,130 @@ func main() {
 
 	controllers.InitMongo(db.Client)
 
+	// ที่เก็บไฟล์: STORAGE_DRIVER=gcs หรือ local (ไม่ตั้งไว้จะใช้ gcs เมื่อมี credential ของ Google)
+	objectStore, err := storage.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("ไม่สามารถตั้งค่าที่เก็บไฟล์: %v", err)
+	}
+	defer gcs.Close()
+	// เอกสารส่วนตัว (รูปบัตรประชาชน) แยกไว้อีกที่ เปิดได้ผ่าน signed URL ของ admin เท่านั้น
+	privateStore, err := storage.NewPrivateFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("ไม่สามารถตั้งค่าที่เก็บเอกสารส่วนตัว: %v", err)
+	}
+	controllers.InitStorage(objectStore, privateStore)
+
+	if err := models.EnsureLedgerIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ ledger: %v", err)
+	}
+	if err := models.EnsurePayoutIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ payouts: %v", err)
+	}
+	if err := models.EnsurePendingRegistrationIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ pending_registrations: %v", err)
+	}
+	if err := models.EnsurePasswordResetIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ password_resets: %v", err)
+	}
+	if err := models.EnsureSessionIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ sessions: %v", err)
+	}
+	if err := models.EnsureLoginChallengeIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ login_challenges: %v", err)
+	}
+
+	if err := models.EnsureUploadSessionIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ upload_sessions: %v", err)
+	}
+	if err := models.EnsureKYCAccessLogIndexes(context.Background()); err != nil {
+		log.Fatalf("ไม่สามารถสร้าง index ของ kyc_access_logs: %v", err)
+	}
+
+	// ย้ายรูปบัตรประชาชนเก่าที่เคยอยู่ใน storage สาธารณะไปที่ private
+	if n, err := controllers.MigrateIDCardImages(context.Background()); err != nil {
+		log.Fatalf("ย้ายรูปบัตรประชาชนไป private storage ไม่สำเร็จ: %v", err)
+	} else if n > 0 {
+		log.Printf("✅ Moved %d ID card images to private storage\n", n)
+	}
+
+	// ผู้ใช้เก่าที่ยังไม่มี roles ให้ได้ buyer (และ seller ถ้าเป็นผู้ขายอยู่แล้ว)
+	if n, err := models.BackfillUserRoles(context.Background()); err != nil {
+		log.Fatalf("ตั้งค่า roles ให้ผู้ใช้เก่าไม่สำเร็จ: %v", err)
+	} else if n > 0 {
+		log.Printf("✅ Backfilled roles for %d users\n", n)
+	}
+
+	// แปลงจำนวนเงินในเอกสารเก่าจากบาทเป็นสตางค์ (int64) ครั้งเดียวต่อ collection ต้องเสร็จก่อนรับ request
+	migrated, err := models.MigrateMoneyToSatang(context.Background())
+	if err != nil {
+		log.Fatalf("แปลงจำนวนเงินเป็นสตางค์ไม่สำเร็จ: %v", err)
+	}
+	log.Printf("Money migration: %v", migrated)
+
+	// เลือกช่องทางชำระเงิน (Omise จริง หรือ fake สำหรับทดสอบ)
+	paymentProvider, err := payments.NewFromEnv()
+	if err != nil {
+		log.Fatalf("ไม่สามารถตั้งค่าระบบชำระเงิน: %v", err)
+	}
+	controllers.InitPayments(paymentProvider)
+	if os.Getenv("OMISE_WEBHOOK_SECRET") == "" {
+		log.Println("⚠️ OMISE_WEBHOOK_SECRET is not set, Omise webhooks will be rejected")
+	}
+
+	// จำกัดจำนวนครั้งของ login / register / password (RATE_LIMIT_STORE=memory หรือ mongo)
+	limiter, err := ratelimit.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("ตั้งค่า rate limit ไม่ถูกต้อง: %v", err)
+	}
+	middlewares.InitRateLimit(limiter)
+
 	// ตั้งค่า router
 	r := gin.Default()
+	// IP ของ proxy ที่เชื่อถือได้ (คั่นด้วย ,) ใช้หา IP จริงของผู้ใช้สำหรับ rate limit
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		if err := r.SetTrustedProxies(strings.Split(proxies, ",")); err != nil {
+			log.Fatalf("TRUSTED_PROXIES ไม่ถูกต้อง: %v", err)
+		}
+	}
 	routes.SetupRoutes(r)
+	// storage แบบ local ให้ Gin เสิร์ฟไฟล์เอง
+	for _, store := range []storage.ObjectStore{objectStore, privateStore} {
+		if local, ok := store.(interface{ RegisterRoutes(*gin.Engine) }); ok {
+			local.RegisterRoutes(r)
+		}
+	}
 
 	log.Println("Starting server on :8080")
 	c := cron.New()
-	c.AddFunc("@every 1m", controllers.DeleteExpiredOrders)
+	c.AddFunc("@every 1m", controllers.ExpireUnpaidOrders)
+
+	// รอบโอนเงินให้ผู้ขาย และกระทบยอดกับ Omise (รูปแบบ cron 5 ช่อง)
+	payoutSchedule := os.Getenv("PAYOUT_SCHEDULE")
+	if payoutSchedule == "" {
+		payoutSchedule = "0 3 * * *"
+	}
+	reconcileSchedule := os.Getenv("RECONCILE_SCHEDULE")
+	if reconcileSchedule == "" {
+		reconcileSchedule = "0 6 * * *"
+	}
+	if _, err := c.AddFunc(payoutSchedule, controllers.RunSellerPayouts); err != nil {
+		log.Fatalf("PAYOUT_SCHEDULE ไม่ถูกต้อง: %v", err)
+	}
+	if _, err := c.AddFunc(reconcileSchedule, controllers.ReconcilePayouts); err != nil {
+		log.Fatalf("RECONCILE_SCHEDULE ไม่ถูกต้อง: %v", err)
+	}
+	c.AddFunc("@every 5m", controllers.RetryDuePayouts)
+
+	// ลบรูปที่ไม่มีสินค้า/ผู้ใช้อ้างถึง ("off" = ปิด)
+	imageGCSchedule := os.Getenv("IMAGE_GC_SCHEDULE")
+	if imageGCSchedule == "" {
+		imageGCSchedule = "30 4 * * *"
+	}
+	if imageGCSchedule != "off" {
+		if _, err := c.AddFunc(imageGCSchedule, controllers.RunImageSweep); err != nil {
+			log.Fatalf("IMAGE_GC_SCHEDULE ไม่ถูกต้อง: %v", err)
+		}
+	}
 	c.Start()
 
 	if err := r.Run(":8080"); err != nil {
@@ -1,85 +1,155 @@
 package middlewares
 
 import (
+	"arttoy-hub/authtoken"
 	"arttoy-hub/database"
 	"arttoy-hub/models"
+	"arttoy-hub/utils"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 	"context"
-	"os"
+	"strings"
+	"time"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString, err := c.Cookie("token")
-		fmt.Println("Token from cookie:", tokenString)
-		if err != nil {
+		tokenString, fromCookie := requestToken(c)
+		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required"})
 			c.Abort()
 			return
 		}
+		// cookie ถูกส่งไปเองโดย browser จึงต้องตรวจ CSRF ส่วน Bearer header ไม่ต้อง
+		if fromCookie && csrfRequired(c) && !utils.ValidCSRF(c) {
+			rejectCSRF(c)
+			return
+		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return jwtSecret, nil
-		})
+		// ตรวจลายเซ็นด้วย key ตาม kid (ดู package authtoken)
+		claims, err := authtoken.Parse(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			fmt.Println("Claims:", claims)
-			userID, exists := claims["user_id"].(string)
-			if !exists {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID missing in token"})
+		fmt.Println("Claims:", claims)
+		userID, exists := claims["user_id"].(string)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID missing in token"})
+			c.Abort()
+			return
+		}
+		// token ที่ผูกกับ session ต้องมี session ที่ยังไม่ถูกยกเลิก
+		if sid, ok := claims["sid"].(string); ok {
+			if !sessionActive(sid, userID) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked, please log in again"})
 				c.Abort()
 				return
 			}
-			c.Set("user_id", userID) // เก็บ user_id ลง context
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Set("session_id", sid)
+		} else if tokenRevoked(userID, claims) {
+			// token แบบเก่าไม่มี sid ใช้ sessions_revoked_at ตัดสินแทน
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked, please log in again"})
 			c.Abort()
+			return
 		}
+		c.Set("user_id", userID) // เก็บ user_id ลง context
+		c.Set("roles", tokenRoles(userID, claims))
+		c.Next()
 	}
 }
-func AdminOnly() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-		if userID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
+// token จาก header "Authorization: Bearer ..." (mobile, script) ถ้าไม่มีใช้ cookie "token"
+func requestToken(c *gin.Context) (token string, fromCookie bool) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token), false
 		}
+	}
+	token, _ = c.Cookie("token")
+	return token, true
+}
 
-		// ดึงข้อมูลผู้ใช้จาก MongoDB
-		objID, _ := primitive.ObjectIDFromHex(userID)
-		userCollection := db.OpenCollection("users")
-		var user models.User
-		err := userCollection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&user)
-		if err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "ไม่พบข้อมูลผู้ใช้"})
-			c.Abort()
-			return
+func sessionActive(sid, userID string) bool {
+	sessionID, err := primitive.ObjectIDFromHex(sid)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := models.ActiveSession(ctx, sessionID)
+	return err == nil && session.UserID.Hex() == userID
+}
+
+// token ที่ออกก่อนผู้ใช้ยกเลิก session (เช่น ตั้งรหัสผ่านใหม่) ใช้ไม่ได้แล้ว
+func tokenRevoked(userID string, claims jwt.MapClaims) bool {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user struct {
+		SessionsRevokedAt time.Time `bson:"sessions_revoked_at"`
+	}
+	err = db.OpenCollection("users").FindOne(ctx, bson.M{"_id": objID},
+		options.FindOne().SetProjection(bson.M{"sessions_revoked_at": 1}),
+	).Decode(&user)
+	if err != nil {
+		return true
+	}
+	if user.SessionsRevokedAt.IsZero() {
+		return false
+	}
+	issuedAt, _ := claims["iat"].(float64)
+	return int64(issuedAt) < user.SessionsRevokedAt.Unix()
+}
+
+// บทบาทจาก claim "roles" ถ้าเป็น token แบบเก่าที่ไม่มี claim นี้จะอ่านจากฐานข้อมูลแทน
+func tokenRoles(userID string, claims jwt.MapClaims) []string {
+	if raw, ok := claims["roles"].([]interface{}); ok {
+		roles := make([]string, 0, len(raw))
+		for _, r := range raw {
+			if role, ok := r.(string); ok {
+				roles = append(roles, role)
+			}
 		}
+		return roles
+	}
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	roles, _ := models.UserRoles(ctx, objID)
+	return roles
+}
 
-		// เงื่อนไข: ถ้า gmail ตรงกับ admin
-		if user.Gmail != "kkong@mail.com" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "เฉพาะผู้ดูแลระบบเท่านั้น"})
+// อนุญาตเฉพาะผู้ใช้ที่มีบทบาทใดบทบาทหนึ่งในรายการ ใช้ต่อจาก AuthMiddleware
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("user_id") == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
-
-		c.Next()
+		have := c.GetStringSlice("roles")
+		for _, want := range roles {
+			if models.HasRole(have, want) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "ไม่มีสิทธิ์เข้าถึง", "required_roles": roles})
+		c.Abort()
 	}
 }
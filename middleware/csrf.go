@@ -0,0 +1,39 @@
+package middlewares
+
+import (
+	"arttoy-hub/utils"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CSRF แบบ double-submit: request ที่เปลี่ยนข้อมูลและยืนยันตัวตนด้วย cookie ต้องส่ง header X-CSRF-Token
+// ให้ตรงกับ cookie csrf_token (ได้ตอน login/refresh หรือ GET /auth/csrf) ปิดได้ด้วย CSRF_PROTECTION=false
+func csrfRequired(c *gin.Context) bool {
+	if os.Getenv("CSRF_PROTECTION") == "false" {
+		return false
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func rejectCSRF(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing CSRF token"})
+	c.Abort()
+}
+
+// CSRFProtect ใช้กับ route ที่ไม่ผ่าน AuthMiddleware แต่อ่าน cookie ชื่อ cookieName เอง เช่น /auth/refresh
+// ถ้า request ไม่ได้ส่ง cookie นั้นมา (เช่น mobile ส่งใน body) ไม่ต้องตรวจ
+func CSRFProtect(cookieName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, err := c.Cookie(cookieName); err == nil && value != "" && csrfRequired(c) && !utils.ValidCSRF(c) {
+			rejectCSRF(c)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProductOwnerOrAdmin อนุญาตเฉพาะผู้ขายเจ้าของสินค้า :id หรือ admin ใช้ต่อจาก AuthMiddleware
+// สินค้าที่โหลดแล้วเก็บไว้ใน context ชื่อ "product"
+func ProductOwnerOrAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var product models.Product
+		if err := db.ProductCollection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			c.Abort()
+			return
+		}
+
+		isOwner := product.SellerID.Hex() == c.GetString("user_id")
+		if !isOwner && !models.HasRole(c.GetStringSlice("roles"), models.RoleAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only modify your own products"})
+			c.Abort()
+			return
+		}
+
+		c.Set("product", product)
+		c.Next()
+	}
+}
@@ -0,0 +1,187 @@
+package middlewares
+
+import (
+	"arttoy-hub/ratelimit"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var limiter *ratelimit.Limiter
+
+type limitKey struct {
+	key  string
+	rule ratelimit.Rule
+}
+
+// InitRateLimit ต้องเรียกก่อนรับ request ถ้าไม่เรียก middleware ในไฟล์นี้จะไม่จำกัดอะไร
+func InitRateLimit(l *ratelimit.Limiter) {
+	limiter = l
+}
+
+// RateLimit จำกัดจำนวนครั้งของ scope (login, register, password) ต่อ IP และต่อค่าใน field ของ JSON body
+func RateLimit(scope string, idFields ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		rules := limiter.Config.Scopes[scope]
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		keys := []limitKey{{scope + ":ip:" + c.ClientIP(), rules.PerIP}}
+		if id := requestIdentifier(c, idFields); id != "" {
+			keys = append(keys, limitKey{scope + ":id:" + id, rules.PerID})
+		}
+
+		for _, k := range keys {
+			wait, err := limiter.Allow(ctx, k.key, k.rule)
+			if err != nil {
+				// store มีปัญหาให้ผ่านไปก่อน ไม่ให้ระบบ login ล่มตาม
+				log.Printf("⚠️ Rate limit store error (%s): %v\n", k.key, err)
+				continue
+			}
+			if wait > 0 {
+				tooManyRequests(c, wait, "Too many requests, please try again later")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// LoginUserResolver หา user ID จาก JSON body ของ /Login คืน "" ถ้าไม่มีผู้ใช้นี้
+type LoginUserResolver func(ctx context.Context, body map[string]interface{}) (string, error)
+
+// LoginLockout ล็อกบัญชีชั่วคราวเมื่อ login ผิดติดกันหลายครั้ง
+// ใช้ user ID ที่ resolve ได้เป็น key เปลี่ยน field ที่ส่งมา (gmail/username/เบอร์โทร) ก็นับรวมกัน
+// ถ้าไม่พบผู้ใช้จะนับตาม identifier ที่ normalize แล้วแทน
+// ดูผลจาก status ของ handler: 401 = ผิด, 2xx = สำเร็จ
+func LoginLockout(resolve LoginUserResolver, idFields ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		body := requestBody(c)
+		id := identifierFrom(body, idFields)
+		if id == "" {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		key := "login:lock:id:" + id
+		if userID, err := resolve(ctx, body); err != nil {
+			log.Printf("⚠️ Failed to resolve login user for lockout: %v\n", err)
+		} else if userID != "" {
+			key = "login:lock:user:" + userID
+		}
+
+		if wait, err := limiter.LockedFor(ctx, key); err != nil {
+			log.Printf("⚠️ Rate limit store error (%s): %v\n", key, err)
+		} else if wait > 0 {
+			tooManyRequests(c, wait, "Too many failed login attempts, account temporarily locked")
+			return
+		}
+
+		c.Next()
+
+		switch status := c.Writer.Status(); {
+		case status == http.StatusUnauthorized:
+			wait, err := limiter.RecordFailure(ctx, key)
+			if err != nil {
+				log.Printf("⚠️ Failed to record login failure (%s): %v\n", key, err)
+			} else if wait > 0 {
+				log.Printf("⚠️ Login locked for %s after repeated failures (ip %s)\n", id, c.ClientIP())
+			}
+		case status >= 200 && status < 300 && c.GetString(LoginCompleteKey) != "":
+			// 200 ที่ยังรอ 2FA ไม่นับว่าสำเร็จ ล้างตัวนับเมื่อได้ session แล้วเท่านั้น
+			resetLoginFailures(ctx, key)
+		}
+	}
+}
+
+// LoginCompleteKey handler ตั้งค่า user ID ไว้ใน gin context เมื่อ login ครบทุกขั้นและออก session แล้ว
+const LoginCompleteKey = "login_complete_user_id"
+
+// LoginLockoutReset ใช้กับ /Login/2fa ล้างตัวนับ login ผิดของผู้ใช้เมื่อยืนยัน 2FA ผ่าน
+func LoginLockoutReset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if limiter == nil {
+			return
+		}
+		if userID := c.GetString(LoginCompleteKey); userID != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			resetLoginFailures(ctx, "login:lock:user:"+userID)
+		}
+	}
+}
+
+func resetLoginFailures(ctx context.Context, key string) {
+	if err := limiter.RecordSuccess(ctx, key); err != nil {
+		log.Printf("⚠️ Failed to reset login failures (%s): %v\n", key, err)
+	}
+}
+
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after": seconds})
+	c.Abort()
+}
+
+// อ่านค่าแรกที่ไม่ว่างจาก field ใน JSON body
+func requestIdentifier(c *gin.Context, fields []string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	return identifierFrom(requestBody(c), fields)
+}
+
+// อ่าน JSON body ครั้งเดียวแล้วคืน body กลับให้ handler อ่านต่อได้
+func requestBody(c *gin.Context) map[string]interface{} {
+	if cached, ok := c.Get("rate_limit_body"); ok {
+		return cached.(map[string]interface{})
+	}
+	if c.Request.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	var payload map[string]interface{}
+	if json.Unmarshal(body, &payload) != nil {
+		return nil
+	}
+	c.Set("rate_limit_body", payload)
+	return payload
+}
+
+func identifierFrom(payload map[string]interface{}, fields []string) string {
+	for _, field := range fields {
+		if value, ok := payload[field].(string); ok {
+			if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/models"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RequireFreshTOTP ใช้กับงานสำคัญ (แก้บัญชีธนาคาร, สั่งโอนเงิน) ต้องส่งรหัสจากแอปใน header X-TOTP-Code ทุกครั้ง
+// ผู้ใช้ที่ยังไม่เปิด 2FA ผ่านได้ เว้นแต่ตั้ง REQUIRE_2FA_FOR_SENSITIVE=true
+func RequireFreshTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := db.OpenCollection("users").FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		if !user.TwoFactorEnabled() {
+			if os.Getenv("REQUIRE_2FA_FOR_SENSITIVE") == "true" {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Enable two-factor authentication to perform this action", "two_factor_setup_required": true})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// ใส่รหัสผิดติดกันหลายครั้งจะถูกล็อก กัน session ที่ถูกขโมยไปเดารหัส 6 หลัก
+		if !totpAllowed(ctx, c, user.ID.Hex()) {
+			return
+		}
+		code := c.GetHeader("X-TOTP-Code")
+		if code == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "A valid two-factor code is required", "two_factor_required": true})
+			c.Abort()
+			return
+		}
+		if models.VerifyTOTP(ctx, user, code) != nil {
+			recordTOTPResult(ctx, user.ID.Hex(), false)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "A valid two-factor code is required", "two_factor_required": true})
+			c.Abort()
+			return
+		}
+		recordTOTPResult(ctx, user.ID.Hex(), true)
+		c.Next()
+	}
+}
+
+// TOTPLockout ใช้กับ handler ที่ตรวจรหัส 2FA เอง (ปิด 2FA, สร้าง recovery code ใหม่)
+// ดูผลจาก status ของ handler: 401 = ผิด, 2xx = สำเร็จ
+func TOTPLockout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if !totpAllowed(ctx, c, userID) {
+			return
+		}
+		c.Next()
+
+		switch status := c.Writer.Status(); {
+		case status == http.StatusUnauthorized:
+			recordTOTPResult(ctx, userID, false)
+		case status >= 200 && status < 300:
+			recordTOTPResult(ctx, userID, true)
+		}
+	}
+}
+
+func totpLockKey(userID string) string {
+	return "totp:lock:" + userID
+}
+
+// ผู้ใช้ถูกล็อกอยู่จะตอบ 429 พร้อม Retry-After แล้วคืน false
+func totpAllowed(ctx context.Context, c *gin.Context, userID string) bool {
+	if limiter == nil {
+		return true
+	}
+	key := totpLockKey(userID)
+	wait, err := limiter.LockedFor(ctx, key)
+	if err != nil {
+		log.Printf("⚠️ Rate limit store error (%s): %v\n", key, err)
+		return true
+	}
+	if wait > 0 {
+		tooManyRequests(c, wait, "Too many invalid two-factor codes, please try again later")
+		return false
+	}
+	return true
+}
+
+// นับรหัสผิดและล็อกเมื่อครบกำหนด (ใช้ค่า LOGIN_LOCKOUT เดียวกับ login) รหัสถูกจะล้างตัวนับ
+func recordTOTPResult(ctx context.Context, userID string, ok bool) {
+	if limiter == nil {
+		return
+	}
+	key := totpLockKey(userID)
+	if ok {
+		if err := limiter.RecordSuccess(ctx, key); err != nil {
+			log.Printf("⚠️ Failed to reset two-factor failures (%s): %v\n", key, err)
+		}
+		return
+	}
+	wait, err := limiter.RecordFailure(ctx, key)
+	if err != nil {
+		log.Printf("⚠️ Failed to record two-factor failure (%s): %v\n", key, err)
+	} else if wait > 0 {
+		log.Printf("⚠️ Two-factor locked for user %s after repeated failures\n", userID)
+	}
+}
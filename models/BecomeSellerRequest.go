@@ -7,5 +7,5 @@ type BecomeSellerRequest struct {
     BankName           string `json:"bank_name" binding:"required"`
     BankAccountNumber  string `json:"bank_account_number" binding:"required"`
     CitizenID          string `json:"citizen_id" binding:"required"`
-    IDCardImageURL     string `json:"id_card_image_url" binding:"required"`
+    IDCardImageKey     string `json:"-"`
 }
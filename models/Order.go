@@ -12,18 +12,23 @@ import (
 type OrderItem struct {
 	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
 	SellerID  primitive.ObjectID `json:"seller_id" bson:"seller_id"`
-	Price     float64            `json:"price" bson:"price"`
+	Price     Money              `json:"price" bson:"price"`
 	Quantity  int                `bson:"quantity" json:"quantity"`
+	Category   string            `json:"category,omitempty" bson:"category,omitempty"`
+	Commission Money             `json:"commission" bson:"commission"` // ค่าคอมมิชชันที่แพลตฟอร์มหัก
+	NetPayout  Money             `json:"net_payout" bson:"net_payout"` // ยอดที่ผู้ขายได้จากสินค้านี้
 	Item      *Product           `json:"item,omitempty" bson:"-"` 
 }
 
 type Order struct {
 	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	UserID          primitive.ObjectID `json:"user_id" bson:"user_id"`
+	SellerID        primitive.ObjectID `json:"seller_id,omitempty" bson:"seller_id,omitempty"`     // ผู้ขายของ order ย่อย (order เก่าไม่มี)
+	CheckoutID      primitive.ObjectID `json:"checkout_id,omitempty" bson:"checkout_id,omitempty"` // การจ่ายเงินรวมที่ order นี้อยู่
 	Items           []OrderItem        `json:"items" bson:"items"`
-	Total           float64            `json:"total" bson:"total"`
-	ShippingFee     float64            `json:"shipping_fee" bson:"shipping_fee"`       
-	GrandTotal      float64            `json:"grand_total" bson:"grand_total"`
+	Total           Money              `json:"total" bson:"total"`
+	ShippingFee     Money              `json:"shipping_fee" bson:"shipping_fee"`       
+	GrandTotal      Money              `json:"grand_total" bson:"grand_total"`
 	ChargeID        string             `json:"charge_id,omitempty" bson:"charge_id,omitempty"`
 	TransferID      string             `json:"transfer_id,omitempty" bson:"transfer_id,omitempty"`
 	Status          string             `json:"status" bson:"status"`
@@ -34,6 +39,16 @@ type Order struct {
 	SourceID        string             `json:"source_id,omitempty" bson:"source_id,omitempty"`
 	PaidAt          time.Time          `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
 	ExpiredAt   time.Time          `bson:"expired_at" json:"expired_at"`
+	Events      []OrderEvent       `json:"events,omitempty" bson:"events,omitempty"`
+	Payouts         []SellerPayout `json:"payouts,omitempty" bson:"payouts,omitempty"`
+	CommissionTotal Money          `json:"commission_total" bson:"commission_total"` // ค่าคอมมิชชัน + ค่าธรรมเนียมคงที่
+	NetPayoutTotal  Money          `json:"net_payout_total" bson:"net_payout_total"`
+	RefundID       string          `json:"refund_id,omitempty" bson:"refund_id,omitempty"`
+	RefundedAt     time.Time       `json:"refunded_at,omitempty" bson:"refunded_at,omitempty"`
+	RefundError    string          `json:"refund_error,omitempty" bson:"refund_error,omitempty"`       // ข้อความ error ล่าสุดถ้าคืนเงินไม่สำเร็จ (รอ admin สั่งใหม่)
+	RefundAttempts int             `json:"refund_attempts,omitempty" bson:"refund_attempts,omitempty"`
+	RefundPending   bool           `json:"refund_pending,omitempty" bson:"refund_pending,omitempty"`     // กำลังขอคืนเงินกับ Omise กันสั่งคืนซ้ำ
+	RefundPendingAt time.Time      `json:"refund_pending_at,omitempty" bson:"refund_pending_at,omitempty"`
 	
 }
 
@@ -42,12 +57,46 @@ func CreateOrder(order Order) (Order, error) {
 	defer cancel()
 
 	order.ID = primitive.NewObjectID()
+	return CreateOrderCtx(ctx, order)
+}
+
+// บันทึก order ด้วย context ที่ส่งมา (ใช้ใน transaction ได้)
+func CreateOrderCtx(ctx context.Context, order Order) (Order, error) {
+	if order.ID.IsZero() {
+		order.ID = primitive.NewObjectID()
+	}
 	order.CreatedAt = time.Now()
+	if len(order.Events) == 0 {
+		order.Events = []OrderEvent{{
+			To:      order.Status,
+			Actor:   ActorBuyer,
+			ActorID: order.UserID,
+			Reason:  "checkout",
+			At:      order.CreatedAt,
+		}}
+	}
 
 	_, err := db.OpenCollection("orders").InsertOne(ctx, order)
 	return order, err
 }
 
+// ตรวจว่าผู้ขายคนนี้เป็นเจ้าของ order
+// order ย่อยดูจาก SellerID ส่วน order เก่าที่ไม่มี SellerID ต้องเป็นสินค้าของผู้ขายคนนี้ทุกชิ้น
+func (o Order) BelongsToSeller(sellerID primitive.ObjectID) bool {
+	if !o.SellerID.IsZero() {
+		return o.SellerID == sellerID
+	}
+	if len(o.Items) == 0 {
+		return false
+	}
+	for _, item := range o.Items {
+		if item.SellerID != sellerID {
+			return false
+		}
+	}
+	return true
+}
+
 func GetOrdersByUser(userID primitive.ObjectID) ([]Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -16,7 +16,7 @@ type CartItemWithProduct struct {
 	ProductID  primitive.ObjectID `json:"product_id"`
 	Name       string             `json:"name"`
 	ImageURL   string             `json:"product_image"`
-	Price      float64            `json:"price"`
+	Price      Money              `json:"price"`
 	Quantity   int                `json:"quantity"`
 	AddedAt    time.Time          `json:"added_at"`
 	SellerName string             `json:"seller_name"`
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// สถานะของการชำระเงินรวม (checkout)
+const (
+	CheckoutWaitingPayment = "waiting_payment"
+	CheckoutPaid           = "paid"
+	CheckoutExpired        = "expired"
+)
+
+// Checkout คือการจ่ายเงินครั้งเดียวของผู้ซื้อ (QR หนึ่งอัน / charge หนึ่งรายการ)
+// ตะกร้าที่มีสินค้าจากผู้ขายหลายคนจะถูกแยกเป็น order ย่อยต่อผู้ขาย แต่ละ order มีสถานะ เลขพัสดุ และค่าส่งของตัวเอง
+type Checkout struct {
+	ID              primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	UserID          primitive.ObjectID   `json:"user_id" bson:"user_id"`
+	OrderIDs        []primitive.ObjectID `json:"order_ids" bson:"order_ids"`
+	Total           Money                `json:"total" bson:"total"`
+	ShippingFee     Money                `json:"shipping_fee" bson:"shipping_fee"` // ค่าส่งรวมของทุก order ย่อย
+	GrandTotal      Money                `json:"grand_total" bson:"grand_total"`
+	ChargeID        string               `json:"charge_id,omitempty" bson:"charge_id,omitempty"`
+	SourceID        string               `json:"source_id,omitempty" bson:"source_id,omitempty"`
+	Status          string               `json:"status" bson:"status"`
+	ShippingAddress Address              `json:"shippingAddress" bson:"shipping_address"`
+	CreatedAt       time.Time            `json:"created_at" bson:"created_at"`
+	PaidAt          time.Time            `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+	ExpiredAt       time.Time            `json:"expired_at" bson:"expired_at"`
+}
+
+func CheckoutCollection() *mongo.Collection {
+	return db.OpenCollection("checkouts")
+}
+
+// แยกสินค้าในตะกร้าเป็น order ย่อยตาม SellerID (เรียงตาม seller เพื่อให้ผลลัพธ์คงที่)
+// order ย่อยแต่ละอันคิดค่าส่งแยกกัน เพราะผู้ขายแต่ละคนส่งของเอง
+func SplitOrderBySeller(base Order, items []OrderItem, shippingFee Money) []Order {
+	groups := map[primitive.ObjectID][]OrderItem{}
+	var sellerIDs []primitive.ObjectID
+	for _, item := range items {
+		if _, ok := groups[item.SellerID]; !ok {
+			sellerIDs = append(sellerIDs, item.SellerID)
+		}
+		groups[item.SellerID] = append(groups[item.SellerID], item)
+	}
+	sort.Slice(sellerIDs, func(i, j int) bool { return sellerIDs[i].Hex() < sellerIDs[j].Hex() })
+
+	var orders []Order
+	for _, sellerID := range sellerIDs {
+		order := base
+		order.ID = primitive.NewObjectID()
+		order.SellerID = sellerID
+		order.Items = groups[sellerID]
+		order.Total = 0
+		for _, item := range order.Items {
+			order.Total += item.Price.Times(item.Quantity)
+		}
+		order.ShippingFee = shippingFee
+		order.GrandTotal = order.Total + shippingFee
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// สร้าง checkout และ order ย่อยทั้งหมด พร้อมจองสินค้าทุกชิ้นใน transaction เดียว
+// ถ้าสินค้าชิ้นใดถูกขายหรือถูกจองไปแล้วจะ rollback ทั้งหมดและคืน ErrProductUnavailable
+func CreateCheckoutWithReservation(ctx context.Context, checkout Checkout, orders []Order) (Checkout, []Order, error) {
+	checkout.ID = primitive.NewObjectID()
+	checkout.CreatedAt = time.Now()
+	checkout.OrderIDs = nil
+	for i := range orders {
+		if orders[i].ID.IsZero() {
+			orders[i].ID = primitive.NewObjectID()
+		}
+		orders[i].CheckoutID = checkout.ID
+		checkout.OrderIDs = append(checkout.OrderIDs, orders[i].ID)
+	}
+
+	session, err := db.Client.StartSession()
+	if err != nil {
+		return Checkout{}, nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var created []Order
+		for _, order := range orders {
+			for _, item := range order.Items {
+				if err := ReserveProduct(sc, item.ProductID, order.ID, order.ExpiredAt); err != nil {
+					return nil, err
+				}
+			}
+			newOrder, err := CreateOrderCtx(sc, order)
+			if err != nil {
+				return nil, err
+			}
+			created = append(created, newOrder)
+		}
+		if _, err := CheckoutCollection().InsertOne(sc, checkout); err != nil {
+			return nil, err
+		}
+		return created, nil
+	})
+	if err != nil {
+		return Checkout{}, nil, err
+	}
+	return checkout, result.([]Order), nil
+}
+
+// ผูก source และ charge ที่สร้างหลังจองสินค้าสำเร็จเข้ากับ checkout และ order ย่อยทั้งหมด
+func AttachCheckoutCharge(ctx context.Context, checkout Checkout, sourceID, chargeID string) error {
+	set := bson.M{"source_id": sourceID, "charge_id": chargeID}
+	return withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if _, err := CheckoutCollection().UpdateByID(sc, checkout.ID, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		_, err := db.OpenCollection("orders").UpdateMany(sc,
+			bson.M{"_id": bson.M{"$in": checkout.OrderIDs}},
+			bson.M{"$set": set},
+		)
+		return err
+	})
+}
+
+// อัปเดตสถานะ checkout ที่ยังรอจ่ายเงิน (ถ้าเปลี่ยนไปแล้วจะไม่ทำอะไร)
+func SetCheckoutStatus(ctx context.Context, checkoutID primitive.ObjectID, status string) error {
+	if checkoutID.IsZero() {
+		return nil
+	}
+	set := bson.M{"status": status}
+	if status == CheckoutPaid {
+		set["paid_at"] = time.Now()
+	}
+	_, err := CheckoutCollection().UpdateOne(ctx,
+		bson.M{"_id": checkoutID, "status": CheckoutWaitingPayment},
+		bson.M{"$set": set},
+	)
+	return err
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ค่าธรรมเนียมที่แพลตฟอร์มหักจากผู้ขาย ตั้งค่าผ่าน env
+//
+//	COMMISSION_PERCENT=10             ค่าคอมมิชชันปกติ (%)
+//	CATEGORY_COMMISSION=Dimoo:8,Molly:12  ค่าคอมมิชชันเฉพาะหมวดหมู่ (%)
+//	ORDER_FIXED_FEE=5                 ค่าธรรมเนียมคงที่ต่อผู้ขายต่อ order (บาท)
+//	SHIPPING_FEE=40                   ค่าส่งที่เก็บจากผู้ซื้อต่อผู้ขาย แล้วส่งต่อให้ผู้ขาย (บาท)
+type FeeConfig struct {
+	CommissionPercent float64
+	CategoryPercent   map[string]float64
+	FixedFee          Money
+	ShippingFee       Money
+}
+
+var Fees = FeeConfig{ShippingFee: 4000}
+
+// ยอดที่ผู้ขายแต่ละคนได้รับจาก order หลังหักค่าธรรมเนียม
+type SellerPayout struct {
+	SellerID   primitive.ObjectID `json:"seller_id" bson:"seller_id"`
+	Gross      Money              `json:"gross" bson:"gross"`           // ราคาสินค้ารวมของผู้ขาย
+	Commission Money              `json:"commission" bson:"commission"` // ค่าคอมมิชชันรวมของสินค้า
+	FixedFee   Money              `json:"fixed_fee" bson:"fixed_fee"`
+	Shipping   Money              `json:"shipping" bson:"shipping"` // ค่าส่งที่ส่งต่อให้ผู้ขาย
+	Net        Money              `json:"net" bson:"net"`           // Gross - Commission - FixedFee + Shipping
+}
+
+func LoadFeeConfig() error {
+	config := FeeConfig{ShippingFee: 4000, CategoryPercent: map[string]float64{}}
+
+	var err error
+	if v := os.Getenv("COMMISSION_PERCENT"); v != "" {
+		if config.CommissionPercent, err = parseCommissionPercent(v); err != nil {
+			return fmt.Errorf("invalid COMMISSION_PERCENT: %v", err)
+		}
+	}
+	if v := os.Getenv("ORDER_FIXED_FEE"); v != "" {
+		if config.FixedFee, err = ParseBaht(v); err != nil {
+			return fmt.Errorf("invalid ORDER_FIXED_FEE: %v", err)
+		}
+	}
+	if v := os.Getenv("SHIPPING_FEE"); v != "" {
+		if config.ShippingFee, err = ParseBaht(v); err != nil {
+			return fmt.Errorf("invalid SHIPPING_FEE: %v", err)
+		}
+	}
+	if v := os.Getenv("CATEGORY_COMMISSION"); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid CATEGORY_COMMISSION entry %q", pair)
+			}
+			rate, err := parseCommissionPercent(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return fmt.Errorf("invalid CATEGORY_COMMISSION rate for %q: %v", parts[0], err)
+			}
+			config.CategoryPercent[strings.TrimSpace(parts[0])] = rate
+		}
+	}
+
+	Fees = config
+	return nil
+}
+
+// ค่าคอมมิชชันต้องอยู่ในช่วง 0 ถึงน้อยกว่า 100% ไม่อย่างนั้นผู้ขายจะได้ยอดติดลบหรือเป็นศูนย์
+func parseCommissionPercent(v string) (float64, error) {
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !(rate >= 0 && rate < 100) {
+		return 0, fmt.Errorf("commission %v%% is out of range [0, 100)", rate)
+	}
+	return rate, nil
+}
+
+func (f FeeConfig) RateFor(category string) float64 {
+	if rate, ok := f.CategoryPercent[category]; ok {
+		return rate
+	}
+	return f.CommissionPercent
+}
+
+// คำนวณค่าคอมมิชชันของแต่ละ OrderItem และยอดสุทธิของผู้ขายแต่ละคน แล้วเก็บลงใน order
+// ค่าส่งแบ่งเท่า ๆ กันให้ผู้ขายทุกคนใน order (เศษสตางค์ให้คนแรก)
+func (f FeeConfig) Apply(order *Order) {
+	payouts := map[primitive.ObjectID]*SellerPayout{}
+	var sellerIDs []primitive.ObjectID
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		gross := item.Price.Times(item.Quantity)
+		item.Commission = gross.Percent(f.RateFor(item.Category))
+		item.NetPayout = gross - item.Commission
+
+		p, ok := payouts[item.SellerID]
+		if !ok {
+			p = &SellerPayout{SellerID: item.SellerID}
+			payouts[item.SellerID] = p
+			sellerIDs = append(sellerIDs, item.SellerID)
+		}
+		p.Gross += gross
+		p.Commission += item.Commission
+	}
+
+	sort.Slice(sellerIDs, func(i, j int) bool { return sellerIDs[i].Hex() < sellerIDs[j].Hex() })
+
+	var shippingShare, shippingRemainder Money
+	if len(sellerIDs) > 0 {
+		shippingShare = order.ShippingFee / Money(len(sellerIDs))
+		shippingRemainder = order.ShippingFee - shippingShare*Money(len(sellerIDs))
+	}
+
+	order.Payouts = nil
+	order.CommissionTotal = 0
+	order.NetPayoutTotal = 0
+	for i, sellerID := range sellerIDs {
+		p := payouts[sellerID]
+		// ค่าธรรมเนียมคงที่ต้องไม่เกินยอดที่ผู้ขายได้
+		p.FixedFee = min(f.FixedFee, p.Gross-p.Commission)
+		p.Shipping = shippingShare
+		if i == 0 {
+			p.Shipping += shippingRemainder
+		}
+		p.Net = p.Gross - p.Commission - p.FixedFee + p.Shipping
+
+		order.Payouts = append(order.Payouts, *p)
+		order.CommissionTotal += p.Commission + p.FixedFee
+		order.NetPayoutTotal += p.Net
+	}
+}
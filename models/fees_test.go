@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+func TestLoadFeeConfigRejectsCommissionOutOfRange(t *testing.T) {
+	for _, tc := range []struct {
+		env, value string
+	}{
+		{"COMMISSION_PERCENT", "-1"},
+		{"COMMISSION_PERCENT", "100"},
+		{"COMMISSION_PERCENT", "150"},
+		{"COMMISSION_PERCENT", "NaN"},
+		{"CATEGORY_COMMISSION", "Dimoo:-5"},
+		{"CATEGORY_COMMISSION", "Dimoo:8,Molly:100"},
+	} {
+		t.Run(tc.env+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			if err := LoadFeeConfig(); err == nil {
+				t.Fatalf("LoadFeeConfig accepted %s=%s", tc.env, tc.value)
+			}
+		})
+	}
+}
+
+func TestLoadFeeConfigAcceptsValidCommission(t *testing.T) {
+	previous := Fees
+	t.Cleanup(func() { Fees = previous })
+
+	t.Setenv("COMMISSION_PERCENT", "0")
+	t.Setenv("CATEGORY_COMMISSION", "Dimoo:8,Molly:99.5")
+	if err := LoadFeeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Fees.RateFor("Molly"); got != 99.5 {
+		t.Fatalf("RateFor(Molly) = %v, want 99.5", got)
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// บันทึกทุกครั้งที่ admin ขอ URL ดูเอกสาร KYC (รูปบัตรประชาชน) ของผู้ขาย
+type KYCAccessLog struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	AdminID   primitive.ObjectID `json:"admin_id" bson:"admin_id"`
+	SellerID  primitive.ObjectID `json:"seller_id" bson:"seller_id"`
+	Document  string             `json:"document" bson:"document"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	IP        string             `json:"ip" bson:"ip"`
+	UserAgent string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"` // เวลาหมดอายุของ URL ที่ออกให้
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+const KYCDocumentIDCard = "id_card"
+
+func KYCAccessLogCollection() *mongo.Collection {
+	return db.OpenCollection("kyc_access_logs")
+}
+
+func EnsureKYCAccessLogIndexes(ctx context.Context) error {
+	_, err := KYCAccessLogCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "seller_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "admin_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+func LogKYCAccess(ctx context.Context, entry KYCAccessLog) error {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	_, err := KYCAccessLogCollection().InsertOne(ctx, entry)
+	return err
+}
+
+// ประวัติการเปิดดูเอกสารของผู้ขาย ล่าสุดก่อน
+func ListKYCAccessLogs(ctx context.Context, sellerID primitive.ObjectID, limit int64) ([]KYCAccessLog, error) {
+	cursor, err := KYCAccessLogCollection().Find(ctx, bson.M{"seller_id": sellerID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	logs := []KYCAccessLog{}
+	err = cursor.All(ctx, &logs)
+	return logs, err
+}
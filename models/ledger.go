@@ -0,0 +1,244 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// บัญชีในสมุดบัญชีคู่ (ledger) ทุก entry ย้ายเงินจาก Debit ไป Credit เสมอ
+// ยอดคงเหลือของบัญชี = ผลรวมที่ถูก credit - ผลรวมที่ถูก debit
+const (
+	AccountGateway  = "gateway"  // เงินที่อยู่ภายนอกระบบ (Omise / บัญชีธนาคาร)
+	AccountEscrow   = "escrow"   // เงินผู้ซื้อที่พักไว้จนกว่าจะยืนยันรับของ
+	AccountPlatform = "platform" // รายได้ของแพลตฟอร์ม
+)
+
+const (
+	LedgerPayment        = "payment"         // ผู้ซื้อจ่ายเงินเข้า escrow
+	LedgerSettlement     = "settlement"      // ยืนยันรับของ ย้ายจาก escrow เข้า wallet ผู้ขาย
+	LedgerRefund         = "refund"          // คืนเงินผู้ซื้อจาก escrow
+	LedgerPayout         = "payout"          // หักเงินจาก wallet ผู้ขายตอนสร้าง payout
+	LedgerPayoutReversal = "payout_reversal" // payout ล้มเหลว คืนยอดกลับเข้า wallet ผู้ขาย
+	LedgerFee            = "fee"             // ค่าธรรมเนียมที่แพลตฟอร์มเก็บ
+)
+
+type LedgerEntry struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Key        string             `json:"-" bson:"key"` // กันบันทึกซ้ำ เช่น payment:<order_id>
+	Type       string             `json:"type" bson:"type"`
+	Debit      string             `json:"debit" bson:"debit"`
+	Credit     string             `json:"credit" bson:"credit"`
+	Amount     Money              `json:"amount" bson:"amount"`
+	OrderID    primitive.ObjectID `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	SellerID   primitive.ObjectID `json:"seller_id,omitempty" bson:"seller_id,omitempty"`
+	TransferID string             `json:"transfer_id,omitempty" bson:"transfer_id,omitempty"`
+	Note       string             `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+func SellerAccount(sellerID primitive.ObjectID) string {
+	return "seller:" + sellerID.Hex()
+}
+
+func ledgerCollection() *mongo.Collection {
+	return db.OpenCollection("ledger")
+}
+
+// สร้าง index ที่ ledger ต้องใช้ เรียกครั้งเดียวตอนเริ่ม server
+func EnsureLedgerIndexes(ctx context.Context) error {
+	_, err := ledgerCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "debit", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "credit", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// บันทึก entry ลง ledger ถ้า key ซ้ำ (เคยบันทึกแล้ว) จะถือว่าสำเร็จ
+func RecordLedger(ctx context.Context, entry LedgerEntry) error {
+	if entry.Amount <= 0 {
+		return nil
+	}
+	entry.ID = primitive.NewObjectID()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	_, err := ledgerCollection().InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// ยอดคงเหลือของบัญชี
+func AccountBalance(ctx context.Context, account string) (Money, error) {
+	cursor, err := ledgerCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": []bson.M{{"debit": account}, {"credit": account}}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"balance": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$credit", account}}, "$amount", bson.M{"$multiply": bson.A{"$amount", -1}},
+			}}},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Balance Money `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Balance, nil
+}
+
+// ประวัติการเคลื่อนไหวของบัญชี ใหม่สุดก่อน
+func AccountHistory(ctx context.Context, account string, limit int64) ([]LedgerEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := ledgerCollection().Find(ctx, bson.M{"$or": []bson.M{{"debit": account}, {"credit": account}}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []LedgerEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ยอดที่ผู้ขายแต่ละคนได้จาก order ใช้ค่าที่คำนวณไว้ตอน checkout
+// order เก่าที่ยังไม่มี payouts จะคำนวณด้วยค่าธรรมเนียมปัจจุบัน
+func OrderPayouts(order Order) []SellerPayout {
+	if len(order.Payouts) > 0 {
+		return order.Payouts
+	}
+	Fees.Apply(&order)
+	return order.Payouts
+}
+
+// ย้ายเงินของ order จาก escrow ไปยัง wallet ผู้ขายแต่ละคน ส่วนค่าธรรมเนียมเข้าแพลตฟอร์ม
+func SettleOrder(ctx context.Context, order Order) error {
+	for _, payout := range OrderPayouts(order) {
+		if err := RecordLedger(ctx, LedgerEntry{
+			Key:      "settlement:" + order.ID.Hex() + ":" + payout.SellerID.Hex(),
+			Type:     LedgerSettlement,
+			Debit:    AccountEscrow,
+			Credit:   SellerAccount(payout.SellerID),
+			Amount:   payout.Net,
+			OrderID:  order.ID,
+			SellerID: payout.SellerID,
+		}); err != nil {
+			return err
+		}
+		if err := RecordLedger(ctx, LedgerEntry{
+			Key:      "fee:" + order.ID.Hex() + ":" + payout.SellerID.Hex(),
+			Type:     LedgerFee,
+			Debit:    AccountEscrow,
+			Credit:   AccountPlatform,
+			Amount:   payout.Commission + payout.FixedFee,
+			OrderID:  order.ID,
+			SellerID: payout.SellerID,
+			Note:     "commission and fixed fee",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// เปลี่ยน order เป็น completed และย้ายเงินเข้า wallet ผู้ขายใน transaction เดียวกัน
+// ถ้าบันทึก ledger ไม่สำเร็จ order จะยังไม่ completed ผู้ซื้อกดยืนยันใหม่ได้
+func CompleteOrder(ctx context.Context, orderID primitive.ObjectID, from string, event OrderEvent) (Order, error) {
+	var completed Order
+	err := withTransaction(ctx, func(sc mongo.SessionContext) error {
+		order, err := TransitionOrder(sc, orderID, from, OrderCompleted, event, nil)
+		if err != nil {
+			return err
+		}
+		completed = order
+		return SettleOrder(sc, order)
+	})
+	return completed, err
+}
+
+// เปลี่ยน order ที่รอจ่ายเงินเป็น pending บันทึกเงินเข้า escrow และตั้ง is_sold ให้สินค้าใน transaction เดียวกัน
+// ถ้าขั้นไหนล้มเหลว order ยังเป็น waiting_payment ให้ webhook ที่ส่งซ้ำทำใหม่ได้ทั้งหมด
+// คืนจำนวนสินค้าที่ตั้งเป็นขายแล้ว
+func PayOrder(ctx context.Context, orderID primitive.ObjectID, event OrderEvent) (Order, int64, error) {
+	var paid Order
+	var sold int64
+	err := withTransaction(ctx, func(sc mongo.SessionContext) error {
+		order, err := TransitionOrder(sc, orderID, OrderWaitingPayment, OrderPending, event, bson.M{
+			"paid_at": time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := RecordOrderPayment(sc, order); err != nil {
+			return err
+		}
+
+		n, err := MarkReservedProductsSold(sc, order.ID)
+		if err != nil {
+			return err
+		}
+		// order เก่าที่สร้างก่อนมีระบบจอง จะไม่มี reserved_by
+		if n < int64(len(order.Items)) {
+			var productIDs []primitive.ObjectID
+			for _, item := range order.Items {
+				productIDs = append(productIDs, item.ProductID)
+			}
+			result, err := db.ProductCollection.UpdateMany(sc, bson.M{
+				"_id":         bson.M{"$in": productIDs},
+				"is_sold":     false,
+				"reserved_by": bson.M{"$exists": false},
+			}, bson.M{"$set": bson.M{"is_sold": true}})
+			if err != nil {
+				return err
+			}
+			n += result.ModifiedCount
+		}
+		paid, sold = order, n
+		return nil
+	})
+	return paid, sold, err
+}
+
+// บันทึกเงินที่ผู้ซื้อจ่ายเข้า escrow
+func RecordOrderPayment(ctx context.Context, order Order) error {
+	return RecordLedger(ctx, LedgerEntry{
+		Key:     "payment:" + order.ID.Hex(),
+		Type:    LedgerPayment,
+		Debit:   AccountGateway,
+		Credit:  AccountEscrow,
+		Amount:  order.GrandTotal,
+		OrderID: order.ID,
+	})
+}
+
+// บันทึกการคืนเงินผู้ซื้อออกจาก escrow
+func RecordOrderRefund(ctx context.Context, order Order, refundID string) error {
+	return RecordLedger(ctx, LedgerEntry{
+		Key:     "refund:" + order.ID.Hex(),
+		Type:    LedgerRefund,
+		Debit:   AccountEscrow,
+		Credit:  AccountGateway,
+		Amount:  order.GrandTotal,
+		OrderID: order.ID,
+		Note:    refundID,
+	})
+}
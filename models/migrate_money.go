@@ -0,0 +1,113 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ก่อน migrate ทุกเอกสารเก็บเป็นบาท ไม่ว่าจะเป็น double, int32, int64 หรือ decimal
+// จึงดูจาก marker แทนการเดาจากชนิดข้อมูล
+const (
+	moneyMigrationID = "money_to_satang"
+	moneyUnitField   = "money_unit" // marker ของแต่ละเอกสาร กันแปลงซ้ำถ้า migration หยุดกลางทาง
+	moneyUnitSatang  = "satang"
+)
+
+// คูณ 100 ทุกชนิดตัวเลข ค่าที่ไม่ใช่ตัวเลข (null, ไม่มี field) ไม่แตะ
+func satangExpr(field string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$isNumber": field},
+		bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{field, 100}}, 0}}},
+		field,
+	}}
+}
+
+// แปลงทุก field ใน element ของ array
+func satangArrayExpr(field string, keys ...string) bson.M {
+	converted := bson.M{}
+	for _, key := range keys {
+		converted[key] = satangExpr("$$el." + key)
+	}
+	return bson.M{"$cond": bson.A{
+		bson.M{"$isArray": field},
+		bson.M{"$map": bson.M{
+			"input": field,
+			"as":    "el",
+			"in":    bson.M{"$mergeObjects": bson.A{"$$el", converted}},
+		}},
+		field,
+	}}
+}
+
+// MigrateMoneyToSatang แปลงจำนวนเงินในเอกสารเก่าจากบาทเป็น int64 สตางค์ ครั้งเดียวต่อ collection
+// collection ที่แปลงเสร็จแล้วจะถูกบันทึกใน migrations และไม่ถูกแตะอีก
+// เอกสารที่แปลงแล้วมี money_unit=satang ถ้าหยุดกลางทาง รอบถัดไปจะแปลงเฉพาะที่เหลือ
+// คืนจำนวนเอกสารที่แก้ไขในแต่ละ collection
+func MigrateMoneyToSatang(ctx context.Context) (map[string]int64, error) {
+	migrations := []struct {
+		collection string
+		set        bson.M
+	}{
+		{
+			collection: "products",
+			set:        bson.M{"price": satangExpr("$price")},
+		},
+		{
+			collection: "orders",
+			set: bson.M{
+				"total":            satangExpr("$total"),
+				"shipping_fee":     satangExpr("$shipping_fee"),
+				"grand_total":      satangExpr("$grand_total"),
+				"commission_total": satangExpr("$commission_total"),
+				"net_payout_total": satangExpr("$net_payout_total"),
+				"items":            satangArrayExpr("$items", "price", "commission", "net_payout"),
+				"payouts":          satangArrayExpr("$payouts", "gross", "commission", "fixed_fee", "shipping", "net"),
+			},
+		},
+		{
+			collection: "checkouts",
+			set: bson.M{
+				"total":        satangExpr("$total"),
+				"shipping_fee": satangExpr("$shipping_fee"),
+				"grand_total":  satangExpr("$grand_total"),
+			},
+		},
+	}
+
+	markers := db.OpenCollection("migrations")
+	result := map[string]int64{}
+	for _, m := range migrations {
+		markerID := moneyMigrationID + ":" + m.collection
+		count, err := markers.CountDocuments(ctx, bson.M{"_id": markerID})
+		if err != nil {
+			return result, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		m.set[moneyUnitField] = moneyUnitSatang
+		res, err := db.OpenCollection(m.collection).UpdateMany(ctx,
+			bson.M{moneyUnitField: bson.M{"$ne": moneyUnitSatang}},
+			mongo.Pipeline{{{Key: "$set", Value: m.set}}},
+		)
+		if err != nil {
+			return result, err
+		}
+		result[m.collection] = res.ModifiedCount
+
+		if _, err := markers.UpdateOne(ctx,
+			bson.M{"_id": markerID},
+			bson.M{"$setOnInsert": bson.M{"done_at": time.Now(), "modified": res.ModifiedCount}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Money คือจำนวนเงินบาท (THB) เก็บเป็นสตางค์แบบจำนวนเต็ม (1 บาท = 100) เพื่อไม่ให้คลาดเคลื่อนจาก float
+//
+// JSON ยังเป็นตัวเลขหน่วยบาท เช่น 120.50 เหมือนเดิม frontend ไม่ต้องแก้
+// BSON เก็บเป็น int64 สตางค์ เอกสารเก่าที่เก็บเป็นบาทถูกแปลงด้วย MigrateMoneyToSatang ตอนเริ่ม server
+type Money int64
+
+const Currency = "thb"
+
+var (
+	ErrInvalidMoney  = errors.New("invalid money amount")
+	ErrNegativeMoney = fmt.Errorf("%w: must not be negative", ErrInvalidMoney)
+)
+
+// แปลงจำนวนบาทแบบ float เป็น Money (ปัดเศษเป็นสตางค์ที่ใกล้ที่สุด)
+func Baht(baht float64) Money {
+	return Money(math.Round(baht * 100))
+}
+
+// แปลงข้อความหน่วยบาท เช่น "120", "120.5", "120.50" เป็น Money โดยไม่ผ่าน float
+// ไม่รับจำนวนติดลบ (ราคา ค่าธรรมเนียม และยอดที่ผู้ใช้ส่งมาต้องไม่ติดลบ)
+func ParseBaht(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-") {
+		return 0, ErrNegativeMoney
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidMoney
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrInvalidMoney
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%w: more than 2 decimal places", ErrInvalidMoney)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	baht, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || baht > math.MaxInt64/100 {
+		return 0, ErrInvalidMoney
+	}
+	satang, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMoney
+	}
+	return Money(baht*100 + satang), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// จำนวนสตางค์ ใช้ส่งให้ Omise
+func (m Money) Satang() int64 {
+	return int64(m)
+}
+
+func (m Money) Baht() float64 {
+	return float64(m) / 100
+}
+
+// คูณจำนวนชิ้น (qty น้อยกว่า 1 ถือเป็น 1 ชิ้น)
+func (m Money) Times(qty int) Money {
+	if qty <= 0 {
+		qty = 1
+	}
+	return m * Money(qty)
+}
+
+// คิดเปอร์เซ็นต์ ปัดเศษเป็นสตางค์ที่ใกล้ที่สุด
+func (m Money) Percent(rate float64) Money {
+	return Money(math.Round(float64(m) * rate / 100))
+}
+
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// รับได้ทั้งตัวเลข (120.5) และข้อความ ("120.50")
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := ParseBaht(s)
+	if err != nil {
+		// ตัวเลขรูปแบบอื่น เช่น 1e3 (ติดลบยังไม่รับเหมือนเดิม)
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || !(f >= 0 && f < math.MaxInt64/100) {
+			return err
+		}
+		v = Baht(f)
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.Int64, bsoncore.AppendInt64(nil, int64(m)), nil
+}
+
+// ทุกชนิดตัวเลขคือสตางค์ (เอกสารเก่าที่เป็นบาทถูก MigrateMoneyToSatang แปลงก่อนเริ่มรับ request แล้ว)
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Int64:
+		v, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		*m = Money(v)
+	case bsontype.Int32:
+		v, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		*m = Money(v)
+	case bsontype.Double:
+		v, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		*m = Money(math.Round(v))
+	case bsontype.Decimal128:
+		v, _, ok := bsoncore.ReadDecimal128(data)
+		if !ok {
+			return ErrInvalidMoney
+		}
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return ErrInvalidMoney
+		}
+		*m = Money(math.Round(f))
+	case bsontype.Null, bsontype.Undefined:
+		*m = 0
+	default:
+		return fmt.Errorf("%w: cannot decode BSON %s", ErrInvalidMoney, t)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseBaht(t *testing.T) {
+	for in, want := range map[string]Money{
+		"120":    12000,
+		"120.5":  12050,
+		"120.50": 12050,
+		".5":     50,
+		" 7 ":    700,
+		"0":      0,
+	} {
+		got, err := ParseBaht(in)
+		if err != nil || got != want {
+			t.Errorf("ParseBaht(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+}
+
+func TestParseBahtRejectsInvalid(t *testing.T) {
+	for _, in := range []string{"", ".", "-1", "-0.50", "1.-5", "1.234", "abc", "1e3", "+-1"} {
+		if got, err := ParseBaht(in); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("ParseBaht(%q) = %v, %v; want ErrInvalidMoney", in, got, err)
+		}
+	}
+	if _, err := ParseBaht("-5"); !errors.Is(err, ErrNegativeMoney) {
+		t.Errorf("ParseBaht(-5) error = %v, want ErrNegativeMoney", err)
+	}
+}
+
+func TestMoneyUnmarshalJSONRejectsNegative(t *testing.T) {
+	for _, in := range []string{`-5`, `"-5.00"`, `-1e3`} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err == nil {
+			t.Errorf("json.Unmarshal(%s) = %v, want error", in, m)
+		}
+	}
+	var m Money
+	if err := json.Unmarshal([]byte(`1e3`), &m); err != nil || m != 100000 {
+		t.Errorf("json.Unmarshal(1e3) = %v, %v; want 1000.00", m, err)
+	}
+}
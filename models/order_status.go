@@ -0,0 +1,110 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// สถานะของ order
+const (
+	OrderWaitingPayment = "waiting_payment" // สร้าง QR แล้ว รอผู้ซื้อจ่าย
+	OrderPending        = "pending"         // จ่ายแล้ว รอผู้ขายรับออเดอร์
+	OrderShipping       = "shipping"        // ผู้ขายรับออเดอร์ กำลังเตรียมส่ง
+	OrderProcessing     = "processing"      // ส่งแล้ว มีเลขพัสดุ รอผู้ซื้อยืนยัน
+	OrderCompleted      = "completed"       // ผู้ซื้อยืนยันรับของแล้ว
+	OrderRejected       = "rejected"        // ผู้ขายปฏิเสธ
+	OrderCancelled      = "cancelled"       // ผู้ซื้อยกเลิก
+	OrderRefunded       = "refunded"        // คืนเงินผู้ซื้อแล้ว
+	OrderExpired        = "expired"         // ไม่จ่ายภายในเวลาที่กำหนด
+)
+
+// ผู้ที่ทำให้สถานะเปลี่ยน
+const (
+	ActorBuyer  = "buyer"
+	ActorSeller = "seller"
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
+	ActorOmise  = "omise"
+)
+
+// สถานะถัดไปที่อนุญาตจากแต่ละสถานะ
+var orderTransitions = map[string][]string{
+	OrderWaitingPayment: {OrderPending, OrderExpired, OrderCancelled},
+	OrderPending:        {OrderShipping, OrderRejected, OrderCancelled},
+	OrderShipping:       {OrderProcessing},
+	OrderProcessing:     {OrderCompleted},
+	OrderRejected:       {OrderRefunded},
+	OrderCancelled:      {OrderRefunded},
+	OrderExpired:        {OrderRefunded}, // ผู้ซื้อจ่ายเข้ามาหลัง order หมดอายุ
+}
+
+// สถานะที่ผู้ขายเห็นในหน้าออเดอร์ (ไม่รวมออเดอร์ที่ยังไม่จ่ายหรือหมดอายุ)
+var SellerVisibleStatuses = []string{
+	OrderPending, OrderShipping, OrderProcessing, OrderCompleted,
+	OrderRejected, OrderCancelled, OrderRefunded,
+}
+
+var (
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	ErrOrderStatusStale  = errors.New("order status has changed")
+)
+
+type OrderEvent struct {
+	From    string             `json:"from,omitempty" bson:"from,omitempty"`
+	To      string             `json:"to" bson:"to"`
+	Actor   string             `json:"actor" bson:"actor"`
+	ActorID primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	Reason  string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	At      time.Time          `json:"at" bson:"at"`
+}
+
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionOrder เปลี่ยนสถานะ order จาก from เป็น to พร้อมบันทึก event ลง timeline
+// อัปเดตแบบมีเงื่อนไข ถ้าสถานะใน DB ไม่ใช่ from แล้วจะคืน ErrOrderStatusStale
+// fields เพิ่มเติม (เช่น paid_at, tracking_number) ส่งมาใน set ได้
+func TransitionOrder(ctx context.Context, orderID primitive.ObjectID, from, to string, event OrderEvent, set bson.M) (Order, error) {
+	if !CanTransition(from, to) {
+		return Order{}, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	event.From = from
+	event.To = to
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	fields := bson.M{"status": to}
+	for k, v := range set {
+		fields[k] = v
+	}
+
+	var order Order
+	err := db.OpenCollection("orders").FindOneAndUpdate(ctx,
+		bson.M{"_id": orderID, "status": from},
+		bson.M{
+			"$set":  fields,
+			"$push": bson.M{"events": event},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return Order{}, ErrOrderStatusStale
+	}
+	return order, err
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCanTransition(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		want     bool
+	}{
+		// เส้นทางปกติ
+		{OrderWaitingPayment, OrderPending, true},
+		{OrderPending, OrderShipping, true},
+		{OrderShipping, OrderProcessing, true},
+		{OrderProcessing, OrderCompleted, true},
+
+		// ยกเลิก หมดอายุ ปฏิเสธ และคืนเงิน
+		{OrderWaitingPayment, OrderExpired, true},
+		{OrderWaitingPayment, OrderCancelled, true},
+		{OrderPending, OrderCancelled, true},
+		{OrderPending, OrderRejected, true},
+		{OrderRejected, OrderRefunded, true},
+		{OrderCancelled, OrderRefunded, true},
+		{OrderExpired, OrderRefunded, true},
+
+		// ข้ามขั้นหรือย้อนกลับไม่ได้
+		{OrderWaitingPayment, OrderShipping, false},
+		{OrderWaitingPayment, OrderRefunded, false},
+		{OrderPending, OrderWaitingPayment, false},
+		{OrderPending, OrderCompleted, false},
+		{OrderPending, OrderRefunded, false},
+		{OrderShipping, OrderCancelled, false},
+		{OrderShipping, OrderRejected, false},
+		{OrderProcessing, OrderShipping, false},
+		{OrderExpired, OrderPending, false},
+
+		// สถานะสุดท้ายไปต่อไม่ได้
+		{OrderCompleted, OrderRefunded, false},
+		{OrderCompleted, OrderCancelled, false},
+		{OrderRefunded, OrderRefunded, false},
+		{OrderRefunded, OrderPending, false},
+
+		// สถานะเดิมหรือสถานะที่ไม่รู้จัก
+		{OrderPending, OrderPending, false},
+		{"", OrderPending, false},
+		{"paid", OrderShipping, false},
+		{OrderPending, "unknown", false},
+	} {
+		if got := CanTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+// ทุกสถานะปลายทางในตารางต้องเป็นสถานะที่รู้จัก
+func TestOrderTransitionsUseKnownStatuses(t *testing.T) {
+	known := map[string]bool{
+		OrderWaitingPayment: true, OrderPending: true, OrderShipping: true, OrderProcessing: true,
+		OrderCompleted: true, OrderRejected: true, OrderCancelled: true, OrderRefunded: true, OrderExpired: true,
+	}
+	for from, next := range orderTransitions {
+		if !known[from] {
+			t.Errorf("unknown source status %q", from)
+		}
+		for _, to := range next {
+			if !known[to] {
+				t.Errorf("%s -> unknown status %q", from, to)
+			}
+		}
+	}
+}
+
+// transition ที่ไม่อยู่ในตารางต้องถูกปฏิเสธก่อนแตะ DB
+func TestTransitionOrderRejectsInvalidTransition(t *testing.T) {
+	_, err := TransitionOrder(context.Background(), primitive.NewObjectID(), OrderCompleted, OrderRefunded, OrderEvent{Actor: ActorAdmin}, nil)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("error = %v, want ErrInvalidTransition", err)
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// token สำหรับตั้งรหัสผ่านใหม่ เก็บเฉพาะ sha256 ของ token ใช้ได้ครั้งเดียว และ Mongo ลบให้เองเมื่อหมดอายุ
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	TokenHash string             `bson:"token_hash"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    time.Time          `bson:"used_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+func PasswordResetCollection() *mongo.Collection {
+	return db.OpenCollection("password_resets")
+}
+
+func EnsurePasswordResetIndexes(ctx context.Context) error {
+	_, err := PasswordResetCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// ใช้ token (ครั้งเดียว) คืน ErrNoDocuments ถ้า token ไม่ถูกต้อง หมดอายุ หรือถูกใช้ไปแล้ว
+func ConsumePasswordReset(ctx context.Context, tokenHash string) (PasswordReset, error) {
+	now := time.Now()
+	var reset PasswordReset
+	err := PasswordResetCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"token_hash": tokenHash,
+			"used_at":    bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&reset)
+	return reset, err
+}
+
+var ErrPasswordResetUser = errors.New("user of reset token not found")
+
+// ใช้ token และตั้งรหัสผ่านใหม่ (พร้อมยกเลิก session เดิม) ใน transaction เดียว
+// ถ้าอัปเดตผู้ใช้ไม่สำเร็จ token จะไม่ถูกใช้ ผู้ใช้ลองใหม่ด้วยลิงก์เดิมได้
+func ResetPasswordWithToken(ctx context.Context, tokenHash, passwordHash string) (PasswordReset, error) {
+	var reset PasswordReset
+	err := withTransaction(ctx, func(sc mongo.SessionContext) error {
+		consumed, err := ConsumePasswordReset(sc, tokenHash)
+		if err != nil {
+			return err
+		}
+		result, err := db.OpenCollection("users").UpdateByID(sc, consumed.UserID, bson.M{
+			"$set": bson.M{
+				"password":            passwordHash,
+				"sessions_revoked_at": time.Now(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrPasswordResetUser
+		}
+		reset = consumed
+		return nil
+	})
+	return reset, err
+}
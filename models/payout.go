@@ -0,0 +1,273 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// สถานะของการโอนเงินออกให้ผู้ขาย
+const (
+	PayoutPending = "pending" // รอโอน หรือรอ retry
+	PayoutPaid    = "paid"    // โอนสำเร็จและบันทึกลง ledger แล้ว
+	PayoutFailed  = "failed"  // retry ครบแล้วยังไม่สำเร็จ รอ admin
+)
+
+// ผลการกระทบยอดกับรายการโอนของ Omise
+const (
+	MismatchMissingTransfer = "missing_transfer" // เราบันทึกว่าโอนแล้วแต่ไม่พบที่ Omise
+	MismatchAmount          = "amount_mismatch"  // ยอดไม่ตรงกัน
+	MismatchTransferFailed  = "transfer_failed"  // Omise แจ้งว่าโอนไม่สำเร็จ
+	MismatchUnknownTransfer = "unknown_transfer" // มีรายการโอนที่ Omise แต่ไม่มีในระบบเรา
+)
+
+type Payout struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SellerID      primitive.ObjectID `json:"seller_id" bson:"seller_id"`
+	BatchID       string             `json:"batch_id" bson:"batch_id"`
+	Amount        Money              `json:"amount" bson:"amount"`
+	Status        string             `json:"status" bson:"status"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	Round         int                `json:"round" bson:"round"`
+	Open          bool               `json:"-" bson:"open,omitempty"` // true จนกว่าจะโอนสำเร็จ มี unique index กันผู้ขายมี payout ค้างพร้อมกันสองรายการ // นับครั้งที่ admin สั่งโอนใหม่ ใช้แยก key ของ ledger
+	NextAttemptAt time.Time          `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	LastError     string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	TransferID    string             `json:"transfer_id,omitempty" bson:"transfer_id,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	PaidAt        time.Time          `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+	ReconciledAt  time.Time          `json:"reconciled_at,omitempty" bson:"reconciled_at,omitempty"`
+	Mismatch      string             `json:"mismatch,omitempty" bson:"mismatch,omitempty"`
+}
+
+// รายการที่กระทบยอดไม่ตรง เก็บไว้ให้ admin ตรวจสอบ
+type PayoutMismatch struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Kind       string             `json:"kind" bson:"kind"`
+	PayoutID   primitive.ObjectID `json:"payout_id,omitempty" bson:"payout_id,omitempty"`
+	TransferID string             `json:"transfer_id,omitempty" bson:"transfer_id,omitempty"`
+	Expected   Money              `json:"expected" bson:"expected"`
+	Actual     Money              `json:"actual" bson:"actual"`
+	Detail     string             `json:"detail,omitempty" bson:"detail,omitempty"`
+	Resolved   bool               `json:"resolved" bson:"resolved"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+func PayoutCollection() *mongo.Collection {
+	return db.OpenCollection("payouts")
+}
+
+func PayoutMismatchCollection() *mongo.Collection {
+	return db.OpenCollection("payout_mismatches")
+}
+
+func EnsurePayoutIndexes(ctx context.Context) error {
+	// payout ที่สร้างก่อนมี field open ยังค้างอยู่ ต้องนับเป็น open ด้วย
+	if _, err := PayoutCollection().UpdateMany(ctx,
+		bson.M{"status": bson.M{"$in": []string{PayoutPending, PayoutFailed}}, "open": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"open": true}},
+	); err != nil {
+		return err
+	}
+	_, err := PayoutCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "seller_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "transfer_id", Value: 1}}},
+		// ผู้ขายหนึ่งคนมี payout ที่ยังไม่จบ (pending/failed) ได้รายการเดียว แม้ job จะรันซ้อนกันหลาย instance
+		{
+			Keys:    bson.D{{Key: "seller_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"open": true}).SetName("one_open_payout_per_seller"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// รายการไม่ตรงเดียวกันบันทึกครั้งเดียว
+	_, err = PayoutMismatchCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "payout_id", Value: 1}, {Key: "transfer_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// ยอดคงเหลือใน wallet ของผู้ขายทุกคนที่มากกว่าศูนย์
+func SellerBalances(ctx context.Context) (map[primitive.ObjectID]Money, error) {
+	cursor, err := ledgerCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{
+			"sides": bson.A{
+				bson.M{"account": "$credit", "amount": "$amount"},
+				bson.M{"account": "$debit", "amount": bson.M{"$multiply": bson.A{"$amount", -1}}},
+			},
+		}}},
+		{{Key: "$unwind", Value: "$sides"}},
+		{{Key: "$match", Value: bson.M{"sides.account": bson.M{"$regex": "^seller:"}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$sides.account", "balance": bson.M{"$sum": "$sides.amount"}}}},
+		{{Key: "$match", Value: bson.M{"balance": bson.M{"$gt": 0}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Account string `bson:"_id"`
+		Balance Money  `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	balances := map[primitive.ObjectID]Money{}
+	for _, row := range rows {
+		sellerID, err := primitive.ObjectIDFromHex(strings.TrimPrefix(row.Account, "seller:"))
+		if err != nil {
+			continue
+		}
+		balances[sellerID] = row.Balance
+	}
+	return balances, nil
+}
+
+// บันทึกรายการไม่ตรง ถ้าเคยบันทึกแล้วจะไม่บันทึกซ้ำ
+func RecordPayoutMismatch(ctx context.Context, mismatch PayoutMismatch) error {
+	mismatch.ID = primitive.NewObjectID()
+	mismatch.CreatedAt = time.Now()
+	_, err := PayoutMismatchCollection().InsertOne(ctx, mismatch)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+var (
+	ErrPayoutNotFailed = errors.New("payout is not failed")
+	ErrPayoutOpen      = errors.New("seller already has an open payout")
+	ErrNoPayoutBalance = errors.New("seller has no balance to pay out")
+)
+
+// key ของ ledger สำหรับ payout แต่ละรอบ รอบแรกใช้ <kind>:<payout_id>
+func payoutLedgerKey(kind string, payout Payout) string {
+	key := kind + ":" + payout.ID.Hex()
+	if payout.Round > 0 {
+		key += ":" + strconv.Itoa(payout.Round)
+	}
+	return key
+}
+
+// หักยอดออกจาก wallet ผู้ขายทันทีที่สร้าง/เริ่มรอบ payout กันรอบถัดไปเห็นยอดเดิมแล้วโอนซ้ำ
+func debitPayout(ctx context.Context, payout Payout) error {
+	return RecordLedger(ctx, LedgerEntry{
+		Key:      payoutLedgerKey("payout", payout),
+		Type:     LedgerPayout,
+		Debit:    SellerAccount(payout.SellerID),
+		Credit:   AccountGateway,
+		Amount:   payout.Amount,
+		SellerID: payout.SellerID,
+		Note:     "payout " + payout.ID.Hex(),
+	})
+}
+
+// สร้าง payout ด้วยยอดคงเหลือล่าสุดของผู้ขาย พร้อมหักยอดใน ledger ใน transaction เดียวกัน
+// ถ้าผู้ขายมี payout ค้างอยู่แล้ว (รวมถึงที่อีก instance เพิ่งสร้าง) จะได้ ErrPayoutOpen
+func CreatePayout(ctx context.Context, payout Payout) (Payout, error) {
+	payout.Open = true
+	err := withTransaction(ctx, func(sc mongo.SessionContext) error {
+		balance, err := AccountBalance(sc, SellerAccount(payout.SellerID))
+		if err != nil {
+			return err
+		}
+		if balance <= 0 {
+			return ErrNoPayoutBalance
+		}
+		payout.Amount = balance
+		if _, err := PayoutCollection().InsertOne(sc, payout); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrPayoutOpen
+			}
+			return err
+		}
+		return debitPayout(sc, payout)
+	})
+	return payout, err
+}
+
+// reference ที่ส่งให้ Omise เป็น idempotency key ของการโอน ใช้ซ้ำได้ใน retry รอบเดียวกัน
+// แต่ admin สั่งโอนใหม่ (round ใหม่) ต้องได้ key ใหม่ ไม่อย่างนั้น Omise จะคืนผลของรอบที่ล้มเหลว
+func PayoutTransferReference(payout Payout) string {
+	if payout.Round == 0 {
+		return payout.ID.Hex()
+	}
+	return payout.ID.Hex() + ":" + strconv.Itoa(payout.Round)
+}
+
+// แยก payout ID ออกจาก reference ของการโอน
+func PayoutIDFromReference(reference string) (primitive.ObjectID, error) {
+	id, _, _ := strings.Cut(reference, ":")
+	return primitive.ObjectIDFromHex(id)
+}
+
+// เปลี่ยน payout เป็น failed และคืนยอดที่หักไว้กลับเข้า wallet ผู้ขาย
+func FailPayout(ctx context.Context, payout Payout, lastError string) error {
+	return withTransaction(ctx, func(sc mongo.SessionContext) error {
+		result, err := PayoutCollection().UpdateOne(sc,
+			bson.M{"_id": payout.ID, "status": PayoutPending},
+			bson.M{
+				"$set":   bson.M{"status": PayoutFailed, "last_error": lastError},
+				"$unset": bson.M{"next_attempt_at": ""},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return nil // สถานะเปลี่ยนไปแล้ว
+		}
+		return RecordLedger(sc, LedgerEntry{
+			Key:      payoutLedgerKey("payout_reversal", payout),
+			Type:     LedgerPayoutReversal,
+			Debit:    AccountGateway,
+			Credit:   SellerAccount(payout.SellerID),
+			Amount:   payout.Amount,
+			SellerID: payout.SellerID,
+			Note:     "payout " + payout.ID.Hex() + " failed",
+		})
+	})
+}
+
+// admin สั่งโอน payout ที่ failed ใหม่ เริ่มรอบใหม่และหักยอดจาก wallet อีกครั้ง
+func RequeuePayout(ctx context.Context, payoutID primitive.ObjectID) error {
+	return withTransaction(ctx, func(sc mongo.SessionContext) error {
+		var payout Payout
+		err := PayoutCollection().FindOneAndUpdate(sc,
+			bson.M{"_id": payoutID, "status": PayoutFailed},
+			bson.M{
+				"$set": bson.M{"status": PayoutPending, "attempts": 0, "next_attempt_at": time.Now()},
+				"$inc": bson.M{"round": 1},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&payout)
+		if err == mongo.ErrNoDocuments {
+			return ErrPayoutNotFailed
+		}
+		if err != nil {
+			return err
+		}
+		return debitPayout(sc, payout)
+	})
+}
+
+// ผูก transfer ID กับรายการหักยอดของ payout รอบนั้น
+func AttachPayoutTransfer(ctx context.Context, payout Payout, transferID string) error {
+	_, err := ledgerCollection().UpdateOne(ctx,
+		bson.M{"key": payoutLedgerKey("payout", payout)},
+		bson.M{"$set": bson.M{"transfer_id": transferID}},
+	)
+	return err
+}
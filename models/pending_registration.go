@@ -0,0 +1,74 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ผู้สมัครที่ขอ OTP แล้วแต่ยังไม่ยืนยัน เอกสารจะถูก Mongo ลบเองเมื่อถึง PurgeAt (TTL index)
+type PendingRegistration struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Gmail        string             `bson:"gmail"`
+	Username     string             `bson:"username"`
+	Phonenumber  string             `bson:"phonenumber"`
+	Password     string             `bson:"password"` // bcrypt แล้ว
+	OTPHash      string             `bson:"otp_hash"` // bcrypt ของ OTP ไม่เก็บตัวเลขจริง
+	OTPExpiresAt time.Time          `bson:"otp_expires_at"`
+	Attempts     int                `bson:"attempts"` // จำนวนครั้งที่กรอกของ OTP ปัจจุบัน (นับก่อนเทียบรหัส)
+	LockedUntil  time.Time          `bson:"locked_until,omitempty"`
+	LastSentAt   time.Time          `bson:"last_sent_at,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at"`
+	PurgeAt      time.Time          `bson:"purge_at"`
+}
+
+func PendingRegistrationCollection() *mongo.Collection {
+	return db.OpenCollection("pending_registrations")
+}
+
+func EnsurePendingRegistrationIndexes(ctx context.Context) error {
+	_, err := PendingRegistrationCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "gmail", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "purge_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func FindPendingRegistration(ctx context.Context, gmail string) (PendingRegistration, error) {
+	var pending PendingRegistration
+	err := PendingRegistrationCollection().FindOne(ctx, bson.M{"gmail": gmail}).Decode(&pending)
+	return pending, err
+}
+
+// จองสิทธิ์กรอก OTP หนึ่งครั้งแบบ atomic ก่อนเทียบรหัส กัน request พร้อมกันเดาเกินจำนวนครั้ง
+// ไม่ match (ครบจำนวนครั้ง ติดล็อก หรือ OTP ถูกขอใหม่แล้ว) จะได้ mongo.ErrNoDocuments
+func ReserveOTPAttempt(ctx context.Context, pending PendingRegistration, maxAttempts int, now time.Time) (PendingRegistration, error) {
+	var updated PendingRegistration
+	err := PendingRegistrationCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":      pending.ID,
+			"otp_hash": pending.OTPHash,
+			"attempts": bson.M{"$lt": maxAttempts},
+			"$or": []bson.M{
+				{"locked_until": bson.M{"$exists": false}},
+				{"locked_until": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	return updated, err
+}
+
+// ล็อกการกรอก OTP และเริ่มนับใหม่เมื่อพ้นล็อก
+func LockPendingRegistration(ctx context.Context, id primitive.ObjectID, until time.Time) error {
+	_, err := PendingRegistrationCollection().UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"locked_until": until, "attempts": 0},
+	})
+	return err
+}
@@ -7,24 +7,53 @@ import (
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "errors"
 )
 
+var ErrProductUnavailable = errors.New("product is sold or reserved")
+
 type Product struct {
     ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
     Name        string             `json:"name" bson:"name"`
     Description string             `json:"description" bson:"description"`
-    Price       float64            `json:"price" bson:"price"`
+    Price       Money              `json:"price" bson:"price"`
     Category    string             `json:"category" bson:"category"`               // จากชื่อ
     Model       string             `json:"model" bson:"model"`
     Color       string             `json:"color" bson:"color"`
     Size        string             `json:"size" bson:"size"`
     ImageURLs   []string           `json:"product_image" bson:"product_image"`
+    ImageVariants []ImageVariant     `json:"image_variants,omitempty" bson:"image_variants,omitempty"` // รูปย่อของแต่ละรูปใน ImageURLs
     Rating      float64            `json:"rating" bson:"rating"`
     SellerID    primitive.ObjectID `json:"seller_id" bson:"seller_id"`
     IsSold      bool               `json:"is_sold" bson:"is_sold"`
+    ReservedBy    primitive.ObjectID `json:"reserved_by,omitempty" bson:"reserved_by,omitempty"`       // order ที่จองสินค้านี้อยู่ระหว่างรอจ่ายเงิน
+    ReservedUntil time.Time          `json:"reserved_until,omitempty" bson:"reserved_until,omitempty"`
     CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
 }
 
+// รูปย่อของรูปสินค้าหนึ่งรูป Original ตรงกับ URL ใน ImageURLs
+type ImageVariant struct {
+    Original  string `json:"original" bson:"original"`
+    Thumbnail string `json:"thumbnail" bson:"thumbnail"`
+    Medium    string `json:"medium" bson:"medium"`
+    WebP      string `json:"webp" bson:"webp"`
+}
+
+// เลือก variant ของรูปที่ยังอยู่ใน urls เรียงตาม urls (รูปเก่าที่ไม่มี variant ก็ข้ามไป)
+func VariantsFor(urls []string, variants []ImageVariant) []ImageVariant {
+    byOriginal := make(map[string]ImageVariant, len(variants))
+    for _, v := range variants {
+        byOriginal[v.Original] = v
+    }
+    result := []ImageVariant{}
+    for _, url := range urls {
+        if v, ok := byOriginal[url]; ok {
+            result = append(result, v)
+        }
+    }
+    return result
+}
 
 // เพิ่มสินค้าใหม่
 func AddProduct(product Product) (Product, error) {
@@ -82,57 +111,194 @@ func GetProductByID(id string) (Product, error) {
     return product, nil
 }
 
-// อัปเดตสินค้า
-func UpdateProduct(id string, updatedProduct Product) (Product, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
+// field ที่ผู้ขายแก้ได้ ค่า nil = ไม่แก้ (PATCH) ส่วน is_sold, rating, seller_id และการจองแก้ผ่านทางนี้ไม่ได้
+type ProductPatch struct {
+    Name        *string   `json:"name"`
+    Description *string   `json:"description"`
+    Price       *Money    `json:"price"`
+    Category    *string   `json:"category"`
+    Model       *string   `json:"model"`
+    Color       *string   `json:"color"`
+    Size        *string   `json:"size"`
+    ImageURLs   *[]string `json:"product_image"`
+    ImageVariants *[]ImageVariant `json:"-"` // ตั้งจาก server เท่านั้น
+}
 
-    objID, err := primitive.ObjectIDFromHex(id)
-    if err != nil {
-        return Product{}, err
+func (p ProductPatch) setDoc() bson.M {
+    set := bson.M{}
+    fields := map[string]*string{
+        "name":        p.Name,
+        "description": p.Description,
+        "category":    p.Category,
+        "model":       p.Model,
+        "color":       p.Color,
+        "size":        p.Size,
+    }
+    for key, value := range fields {
+        if value != nil {
+            set[key] = *value
+        }
+    }
+    if p.Price != nil {
+        set["price"] = *p.Price
+    }
+    if p.ImageURLs != nil {
+        set["product_image"] = *p.ImageURLs
     }
+    if p.ImageVariants != nil {
+        set["image_variants"] = *p.ImageVariants
+    }
+    return set
+}
 
-    update := bson.M{
-        "$set": bson.M{
-            "name":         updatedProduct.Name,
-            "description":  updatedProduct.Description,
-            "price":        updatedProduct.Price,
-            "category":     updatedProduct.Category,
-            "model":        updatedProduct.Model,
-            "color":        updatedProduct.Color,
-            "size":         updatedProduct.Size,
-            "product_image": updatedProduct.ImageURLs,
-            "rating":       updatedProduct.Rating,
-            "seller_id":    updatedProduct.SellerID,
-            "is_sold":      updatedProduct.IsSold,
-        },
+// สินค้าที่ขายแล้วหรือมี order จองอยู่ห้ามแก้หรือลบ
+func (p Product) Locked() bool {
+    return p.IsSold || !p.ReservedBy.IsZero()
+}
+
+func unlockedProductFilter(id primitive.ObjectID) bson.M {
+    return bson.M{
+        "_id":         id,
+        "is_sold":     false,
+        "reserved_by": bson.M{"$exists": false},
     }
+}
 
-    _, err = db.ProductCollection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+// สินค้าหาไม่เจอ หรือถูกล็อกระหว่างที่กำลังแก้
+func productMissingOrLocked(ctx context.Context, id primitive.ObjectID) error {
+    count, err := db.ProductCollection.CountDocuments(ctx, bson.M{"_id": id})
     if err != nil {
-        return Product{}, err
+        return err
+    }
+    if count == 0 {
+        return mongo.ErrNoDocuments
     }
+    return ErrProductUnavailable
+}
 
-    updatedProduct.ID = objID
-    return updatedProduct, nil
+// ต่อรูปใหม่ท้ายรูปเดิมของสินค้า (สินค้าต้องยังไม่ขายหรือถูกจอง)
+func AppendProductImages(ctx context.Context, id primitive.ObjectID, variants []ImageVariant) (Product, error) {
+    urls := make([]string, 0, len(variants))
+    for _, v := range variants {
+        urls = append(urls, v.Original)
+    }
+    var product Product
+    err := db.ProductCollection.FindOneAndUpdate(ctx,
+        unlockedProductFilter(id),
+        bson.M{"$push": bson.M{
+            "product_image":  bson.M{"$each": urls},
+            "image_variants": bson.M{"$each": variants},
+        }},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&product)
+    if err == mongo.ErrNoDocuments {
+        return Product{}, productMissingOrLocked(ctx, id)
+    }
+    return product, err
 }
 
-// ลบสินค้า
-func DeleteProduct(id string) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
+// แก้สินค้าบางส่วน สำเร็จเฉพาะเมื่อสินค้ายังไม่ขายและไม่มีใครจอง (เช็กในคำสั่งเดียวกัน)
+func PatchProduct(ctx context.Context, id primitive.ObjectID, patch ProductPatch) (Product, error) {
+    set := patch.setDoc()
+    if len(set) == 0 {
+        var product Product
+        err := db.ProductCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&product)
+        return product, err
+    }
 
-    objID, err := primitive.ObjectIDFromHex(id)
+    var product Product
+    err := db.ProductCollection.FindOneAndUpdate(ctx,
+        unlockedProductFilter(id),
+        bson.M{"$set": set},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&product)
+    if err == mongo.ErrNoDocuments {
+        return Product{}, productMissingOrLocked(ctx, id)
+    }
+    return product, err
+}
+
+// ลบสินค้าที่ยังไม่ขายและไม่มีใครจอง
+func DeleteProduct(ctx context.Context, id primitive.ObjectID) error {
+    result, err := db.ProductCollection.DeleteOne(ctx, unlockedProductFilter(id))
     if err != nil {
         return err
     }
+    if result.DeletedCount == 0 {
+        return productMissingOrLocked(ctx, id)
+    }
+    return nil
+}
 
-    result, err := db.ProductCollection.DeleteOne(ctx, bson.M{"_id": objID})
+// จองสินค้าให้ order แบบมีเงื่อนไข สำเร็จเฉพาะเมื่อยังไม่ขายและยังไม่มีใครจอง
+func ReserveProduct(ctx context.Context, productID, orderID primitive.ObjectID, until time.Time) error {
+    result, err := db.ProductCollection.UpdateOne(ctx,
+        bson.M{
+            "_id":         productID,
+            "is_sold":     false,
+            "reserved_by": bson.M{"$exists": false},
+        },
+        bson.M{"$set": bson.M{
+            "reserved_by":    orderID,
+            "reserved_until": until,
+        }},
+    )
     if err != nil {
         return err
     }
-    if result.DeletedCount == 0 {
-        return mongo.ErrNoDocuments
+    if result.MatchedCount == 0 {
+        return ErrProductUnavailable
     }
     return nil
 }
+
+// ปล่อยสินค้าทั้งหมดที่ order นี้จองไว้
+func ReleaseReservations(ctx context.Context, orderID primitive.ObjectID) error {
+    _, err := db.ProductCollection.UpdateMany(ctx,
+        bson.M{"reserved_by": orderID},
+        bson.M{"$unset": bson.M{"reserved_by": "", "reserved_until": ""}},
+    )
+    return err
+}
+
+// ตั้งสินค้าที่ order จองไว้ให้เป็นขายแล้ว คืนจำนวนชิ้นที่อัปเดตได้
+func MarkReservedProductsSold(ctx context.Context, orderID primitive.ObjectID) (int64, error) {
+    result, err := db.ProductCollection.UpdateMany(ctx,
+        bson.M{"reserved_by": orderID, "is_sold": false},
+        bson.M{
+            "$set":   bson.M{"is_sold": true},
+            "$unset": bson.M{"reserved_by": "", "reserved_until": ""},
+        },
+    )
+    if err != nil {
+        return 0, err
+    }
+    return result.ModifiedCount, nil
+}
+
+// นำสินค้าใน order กลับมาขายใหม่ (ใช้ตอนผู้ขายปฏิเสธหรือผู้ซื้อยกเลิก)
+// ไม่แตะสินค้าที่ order อื่นจองอยู่
+func RestockOrderProducts(ctx context.Context, order Order) error {
+    var productIDs []primitive.ObjectID
+    for _, item := range order.Items {
+        productIDs = append(productIDs, item.ProductID)
+    }
+    if len(productIDs) == 0 {
+        return nil
+    }
+
+    _, err := db.ProductCollection.UpdateMany(ctx,
+        bson.M{
+            "_id": bson.M{"$in": productIDs},
+            "$or": []bson.M{
+                {"reserved_by": order.ID},
+                {"reserved_by": bson.M{"$exists": false}},
+            },
+        },
+        bson.M{
+            "$set":   bson.M{"is_sold": false},
+            "$unset": bson.M{"reserved_by": "", "reserved_until": ""},
+        },
+    )
+    return err
+}
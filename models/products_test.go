@@ -0,0 +1,196 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ต่อ MongoDB สำหรับเทสต์ ใช้ database แยกแล้วลบทิ้งเมื่อจบ ถ้าไม่ได้ตั้ง MONGODB_TEST_URI จะข้าม
+func useTestProductCollection(t *testing.T) *mongo.Collection {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	previousClient, previousName, previousProducts := db.Client, db.DatabaseName, db.ProductCollection
+	db.Client = client
+	db.DatabaseName = "arttoyhub_test_" + primitive.NewObjectID().Hex()
+	db.ProductCollection = db.OpenCollection("products")
+	t.Cleanup(func() {
+		client.Database(db.DatabaseName).Drop(context.Background())
+		db.Client, db.DatabaseName, db.ProductCollection = previousClient, previousName, previousProducts
+		client.Disconnect(context.Background())
+	})
+	return db.ProductCollection
+}
+
+// ผู้ซื้อสองคนจองสินค้าชิ้นเดียวกันพร้อมกัน ต้องได้คนเดียว
+func TestReserveProductConcurrentBuyers(t *testing.T) {
+	products := useTestProductCollection(t)
+	ctx := context.Background()
+
+	productID := primitive.NewObjectID()
+	if _, err := products.InsertOne(ctx, bson.M{"_id": productID, "name": "Labubu", "is_sold": false}); err != nil {
+		t.Fatal(err)
+	}
+
+	buyers := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	errs := make([]error, len(buyers))
+	until := time.Now().Add(15 * time.Minute)
+
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i, orderID := range buyers {
+		done.Add(1)
+		go func(i int, orderID primitive.ObjectID) {
+			defer done.Done()
+			start.Wait()
+			errs[i] = ReserveProduct(ctx, productID, orderID, until)
+		}(i, orderID)
+	}
+	start.Done()
+	done.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner != -1 {
+				t.Fatal("both buyers reserved the same product")
+			}
+			winner = i
+		case errors.Is(err, ErrProductUnavailable):
+		default:
+			t.Fatalf("buyer %d: unexpected error: %v", i, err)
+		}
+	}
+	if winner == -1 {
+		t.Fatal("no buyer reserved the product")
+	}
+
+	var product struct {
+		ReservedBy primitive.ObjectID `bson:"reserved_by"`
+	}
+	if err := products.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		t.Fatal(err)
+	}
+	if product.ReservedBy != buyers[winner] {
+		t.Fatalf("reserved_by = %s, want %s", product.ReservedBy.Hex(), buyers[winner].Hex())
+	}
+
+	// ปล่อยการจองแล้วอีกคนต้องจองได้
+	if err := ReleaseReservations(ctx, buyers[winner]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReserveProduct(ctx, productID, buyers[1-winner], until); err != nil {
+		t.Fatalf("reserve after release: %v", err)
+	}
+}
+
+// ผู้ซื้อหลายคน checkout สินค้าชิ้นเดียวกันพร้อมกันผ่าน transaction จริง ต้องได้ order และการจองเดียว
+// ต้องเป็น replica set เพราะใช้ transaction
+func TestCreateCheckoutConcurrentBuyers(t *testing.T) {
+	products := useTestProductCollection(t)
+	ctx := context.Background()
+
+	productID, sellerID := primitive.NewObjectID(), primitive.NewObjectID()
+	if _, err := products.InsertOne(ctx, bson.M{"_id": productID, "name": "Labubu", "seller_id": sellerID, "is_sold": false}); err != nil {
+		t.Fatal(err)
+	}
+	// สร้าง collection ไว้ก่อน transaction
+	for _, name := range []string{"orders", "checkouts"} {
+		if err := db.Client.Database(db.DatabaseName).CreateCollection(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const buyers = 8
+	results := make([][]Order, buyers)
+	errs := make([]error, buyers)
+	expiredAt := time.Now().Add(15 * time.Minute)
+
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < buyers; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			buyerID := primitive.NewObjectID()
+			items := []OrderItem{{ProductID: productID, SellerID: sellerID, Price: Money(125000), Quantity: 1}}
+			orders := SplitOrderBySeller(Order{UserID: buyerID, Status: OrderWaitingPayment, ExpiredAt: expiredAt}, items, 0)
+			start.Wait()
+			_, results[i], errs[i] = CreateCheckoutWithReservation(ctx, Checkout{
+				UserID:    buyerID,
+				Status:    CheckoutWaitingPayment,
+				ExpiredAt: expiredAt,
+			}, orders)
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner != -1 {
+				t.Fatalf("buyers %d and %d both checked out the same product", winner, i)
+			}
+			winner = i
+		case errors.Is(err, ErrProductUnavailable):
+		default:
+			t.Fatalf("buyer %d: unexpected error: %v", i, err)
+		}
+	}
+	if winner == -1 {
+		t.Fatal("no buyer checked out the product")
+	}
+
+	for name, want := range map[string]int64{"orders": 1, "checkouts": 1} {
+		n, err := db.OpenCollection(name).CountDocuments(ctx, bson.M{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("%s = %d, want %d", name, n, want)
+		}
+	}
+	reserved, err := products.CountDocuments(ctx, bson.M{"reserved_by": bson.M{"$exists": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved != 1 {
+		t.Fatalf("reserved products = %d, want 1", reserved)
+	}
+
+	var product struct {
+		ReservedBy primitive.ObjectID `bson:"reserved_by"`
+	}
+	if err := products.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		t.Fatal(err)
+	}
+	if product.ReservedBy != results[winner][0].ID {
+		t.Fatalf("reserved_by = %s, want winning order %s", product.ReservedBy.Hex(), results[winner][0].ID.Hex())
+	}
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RoleBuyer     = "buyer"
+	RoleSeller    = "seller"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var AllRoles = []string{RoleBuyer, RoleSeller, RoleModerator, RoleAdmin}
+
+var (
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrUserNotFound = errors.New("user not found")
+	ErrLastAdmin    = errors.New("cannot revoke the last admin")
+)
+
+func ValidRole(role string) bool {
+	for _, r := range AllRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// บทบาทของผู้ใช้ ถ้าเอกสารเก่ายังไม่มี roles จะอนุมานจาก is_seller
+func (u User) EffectiveRoles() []string {
+	if len(u.Roles) > 0 {
+		return u.Roles
+	}
+	roles := []string{RoleBuyer}
+	if u.IsSeller {
+		roles = append(roles, RoleSeller)
+	}
+	return roles
+}
+
+func (u User) HasRole(role string) bool {
+	return HasRole(u.EffectiveRoles(), role)
+}
+
+func HasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// อ่านบทบาทล่าสุดของผู้ใช้จากฐานข้อมูล ใช้ตอนออก access token
+func UserRoles(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	var user User
+	err := db.OpenCollection("users").FindOne(ctx, bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"roles": 1, "is_seller": 1}),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return user.EffectiveRoles(), nil
+}
+
+// BackfillUserRoles ใส่ roles ให้ผู้ใช้เก่าที่ยังไม่มี (buyer และ seller ถ้า is_seller) เรียกซ้ำได้
+func BackfillUserRoles(ctx context.Context) (int64, error) {
+	result, err := db.OpenCollection("users").UpdateMany(ctx,
+		bson.M{"roles": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{"roles": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$is_seller", true}},
+			bson.A{RoleBuyer, RoleSeller},
+			bson.A{RoleBuyer},
+		}}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// เพิ่มบทบาทให้ผู้ใช้ (seller จะตั้ง is_seller ให้ตรงกันด้วย)
+func GrantRole(ctx context.Context, userID primitive.ObjectID, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+	update := bson.M{"$addToSet": bson.M{"roles": role}}
+	if role == RoleSeller {
+		update["$set"] = bson.M{"is_seller": true}
+	}
+	result, err := db.OpenCollection("users").UpdateByID(ctx, userID, update)
+	if err == nil && result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func RevokeRole(ctx context.Context, userID primitive.ObjectID, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+	update := bson.M{"$pull": bson.M{"roles": role}}
+	if role == RoleSeller {
+		update["$set"] = bson.M{"is_seller": false}
+	}
+	result, err := db.OpenCollection("users").UpdateByID(ctx, userID, update)
+	if err == nil && result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// ถอน admin โดยต้องเหลือ admin อย่างน้อยหนึ่งคนเสมอ นับและถอนใน transaction เดียวกัน
+// ทุกครั้งที่ถอน admin จะเขียนเอกสาร lock ตัวเดียวกัน ถ้าถอนพร้อมกันสอง request จะชนกันและถูกลองใหม่
+// รอบที่ลองใหม่จะนับได้จำนวนล่าสุด จึงไม่มีทางถอน admin คนสุดท้ายออกได้
+func RevokeAdminRole(ctx context.Context, userID primitive.ObjectID) error {
+	return withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if _, err := db.OpenCollection("locks").UpdateOne(sc,
+			bson.M{"_id": "role:" + RoleAdmin},
+			bson.M{"$inc": bson.M{"version": 1}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return err
+		}
+
+		roles, err := UserRoles(sc, userID)
+		if err == mongo.ErrNoDocuments {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !HasRole(roles, RoleAdmin) {
+			return nil
+		}
+		admins, err := CountUsersWithRole(sc, RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+		return RevokeRole(sc, userID, RoleAdmin)
+	})
+}
+
+func CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	return db.OpenCollection("users").CountDocuments(ctx, bson.M{"roles": role})
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// session ฝั่ง server หนึ่งรายการต่อการ login หนึ่งครั้ง (หนึ่งอุปกรณ์)
+// access token อ้างถึง session ผ่าน claim "sid" ส่วน refresh token เก็บเฉพาะ sha256
+type Session struct {
+	ID                  primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID              primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RefreshHash         string             `json:"-" bson:"refresh_hash"`
+	PreviousRefreshHash string             `json:"-" bson:"previous_refresh_hash,omitempty"` // ใช้ตรวจ refresh token ที่ถูกขโมยไปใช้ซ้ำ
+	UserAgent           string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	IP                  string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt          time.Time          `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt           time.Time          `json:"expires_at" bson:"expires_at"`
+	RevokedAt           time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+var (
+	ErrSessionNotFound    = errors.New("session not found or expired")
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+func SessionCollection() *mongo.Collection {
+	return db.OpenCollection("sessions")
+}
+
+func EnsureSessionIndexes(ctx context.Context) error {
+	_, err := SessionCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "refresh_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "previous_refresh_hash", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func CreateSession(ctx context.Context, session Session) (Session, error) {
+	session.ID = primitive.NewObjectID()
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+	_, err := SessionCollection().InsertOne(ctx, session)
+	return session, err
+}
+
+// session ที่ยังใช้งานได้ (ไม่ถูกยกเลิกและยังไม่หมดอายุ)
+func ActiveSession(ctx context.Context, sessionID primitive.ObjectID) (Session, error) {
+	var session Session
+	err := SessionCollection().FindOne(ctx, bson.M{
+		"_id":        sessionID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return session, ErrSessionNotFound
+	}
+	return session, err
+}
+
+// เปลี่ยน refresh token ของ session (rotate) แบบมีเงื่อนไขว่า token เดิมยังเป็นอันล่าสุด
+// ถ้า token เดิมเคยถูก rotate ไปแล้ว แปลว่ามีคนเอา token เก่ามาใช้ซ้ำ จะยกเลิก session ทันที
+func RotateSession(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (Session, error) {
+	now := time.Now()
+	var session Session
+	err := SessionCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"refresh_hash": oldHash,
+			"revoked_at":   bson.M{"$exists": false},
+			"expires_at":   bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{
+			"refresh_hash":          newHash,
+			"previous_refresh_hash": oldHash,
+			"last_used_at":          now,
+			"expires_at":            expiresAt,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err == nil {
+		return session, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return session, err
+	}
+
+	result, err := SessionCollection().UpdateOne(ctx,
+		bson.M{"previous_refresh_hash": oldHash, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	if err == nil && result.ModifiedCount > 0 {
+		return Session{}, ErrRefreshTokenReused
+	}
+	return Session{}, ErrSessionNotFound
+}
+
+func RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error {
+	_, err := SessionCollection().UpdateOne(ctx,
+		bson.M{"_id": sessionID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// ยกเลิกทุก session ของผู้ใช้ (ออกจากระบบทุกอุปกรณ์)
+func RevokeUserSessions(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := SessionCollection().UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
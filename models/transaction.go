@@ -0,0 +1,22 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// รัน fn ใน transaction ของ MongoDB (ต้องเป็น replica set) ถ้าชนกับ transaction อื่นจะลองใหม่ให้เอง
+func withTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := db.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
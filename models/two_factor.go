@@ -0,0 +1,128 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"arttoy-hub/utils"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ตั้งค่า 2FA แบบ TOTP ของผู้ใช้ ไม่ส่งออกทาง JSON
+type TwoFactor struct {
+	Enabled       bool      `bson:"enabled"`
+	Secret        string    `bson:"secret,omitempty"`
+	PendingSecret string    `bson:"pending_secret,omitempty"` // secret ที่ขอตั้งค่าแล้วแต่ยังไม่ยืนยัน
+	RecoveryCodes []string  `bson:"recovery_codes,omitempty"` // sha256 ของ recovery code ที่ยังไม่ถูกใช้
+	LastUsedStep  int64     `bson:"last_used_step,omitempty"` // กันการใช้รหัส TOTP เดิมซ้ำ
+	EnabledAt     time.Time `bson:"enabled_at,omitempty"`
+}
+
+var ErrInvalidTOTP = errors.New("invalid two-factor code")
+
+func (u User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled && u.TwoFactor.Secret != ""
+}
+
+// VerifyTOTP ตรวจรหัสจากแอป authenticator รหัสที่ใช้แล้วจะใช้ซ้ำไม่ได้
+func VerifyTOTP(ctx context.Context, user User, code string) error {
+	if !user.TwoFactorEnabled() {
+		return ErrInvalidTOTP
+	}
+	step, ok := utils.MatchTOTP(user.TwoFactor.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTP
+	}
+	result, err := db.OpenCollection("users").UpdateOne(ctx,
+		bson.M{
+			"_id":                       user.ID,
+			"two_factor.enabled":        true,
+			"two_factor.last_used_step": bson.M{"$not": bson.M{"$gte": step}},
+		},
+		bson.M{"$set": bson.M{"two_factor.last_used_step": step}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidTOTP
+	}
+	return nil
+}
+
+// UseRecoveryCode ใช้ recovery code (ส่งมาเป็น hash) ได้ครั้งเดียว
+func UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, codeHash string) error {
+	result, err := db.OpenCollection("users").UpdateOne(ctx,
+		bson.M{"_id": userID, "two_factor.enabled": true, "two_factor.recovery_codes": codeHash},
+		bson.M{"$pull": bson.M{"two_factor.recovery_codes": codeHash}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrInvalidTOTP
+	}
+	return nil
+}
+
+// ขั้นตอนที่สองของ login สำหรับผู้ใช้ที่เปิด 2FA เก็บเฉพาะ hash ของ token
+type LoginChallenge struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	TokenHash string             `bson:"token_hash"`
+	Attempts  int                `bson:"attempts"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+func LoginChallengeCollection() *mongo.Collection {
+	return db.OpenCollection("login_challenges")
+}
+
+func EnsureLoginChallengeIndexes(ctx context.Context) error {
+	_, err := LoginChallengeCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func FindLoginChallenge(ctx context.Context, tokenHash string) (LoginChallenge, error) {
+	var challenge LoginChallenge
+	err := LoginChallengeCollection().FindOne(ctx, bson.M{
+		"token_hash": tokenHash,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&challenge)
+	return challenge, err
+}
+
+// นับครั้งที่กรอกผิด ครบ maxAttempts แล้วลบ challenge ทิ้ง ต้อง login ใหม่
+func FailLoginChallenge(ctx context.Context, id primitive.ObjectID, maxAttempts int) error {
+	var challenge LoginChallenge
+	err := LoginChallengeCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&challenge)
+	if err != nil {
+		return err
+	}
+	if challenge.Attempts >= maxAttempts {
+		_, err = LoginChallengeCollection().DeleteOne(ctx, bson.M{"_id": id})
+	}
+	return err
+}
+
+// ใช้ challenge ได้ครั้งเดียว คืน false ถ้ามีคนใช้ไปก่อนแล้ว
+func ConsumeLoginChallenge(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := LoginChallengeCollection().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// สถานะของ upload session
+const (
+	UploadSessionOpen       = "open"       // รอ client อัปโหลดตรงไปที่ storage
+	UploadSessionFinalizing = "finalizing" // server กำลังตรวจไฟล์
+	UploadSessionFinalized  = "finalized"  // ตรวจแล้ว รอผูกกับสินค้า
+	UploadSessionAttached   = "attached"   // ผูกกับสินค้าแล้ว ใช้ซ้ำไม่ได้
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found or expired")
+	ErrUploadSessionState    = errors.New("upload session is not in the expected state")
+)
+
+// session อัปโหลดรูปสินค้าตรงไปที่ storage ด้วย URL แบบ signed
+// Keys = ช่องที่ออกให้ client, Images = รูปที่ตรวจและสร้าง variant แล้วตอน finalize
+type UploadSession struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Keys      []string           `json:"keys" bson:"keys"`
+	Status    string             `json:"status" bson:"status"`
+	Images    []ImageVariant     `json:"images,omitempty" bson:"images,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+func UploadSessionCollection() *mongo.Collection {
+	return db.OpenCollection("upload_sessions")
+}
+
+func EnsureUploadSessionIndexes(ctx context.Context) error {
+	_, err := UploadSessionCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func CreateUploadSession(ctx context.Context, session UploadSession) (UploadSession, error) {
+	session.CreatedAt = time.Now()
+	session.Status = UploadSessionOpen
+	_, err := UploadSessionCollection().InsertOne(ctx, session)
+	return session, err
+}
+
+// เปลี่ยนสถานะ session ของผู้ใช้จาก from เป็น to ในคำสั่งเดียว (กันการ finalize หรือผูกซ้ำพร้อมกัน)
+func transitionUploadSession(ctx context.Context, id, userID primitive.ObjectID, from, to string, set bson.M) (UploadSession, error) {
+	if set == nil {
+		set = bson.M{}
+	}
+	set["status"] = to
+	var session UploadSession
+	err := UploadSessionCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "user_id": userID, "status": from, "expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err != mongo.ErrNoDocuments {
+		return session, err
+	}
+	count, err := UploadSessionCollection().CountDocuments(ctx, bson.M{"_id": id, "user_id": userID, "expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return UploadSession{}, err
+	}
+	if count == 0 {
+		return UploadSession{}, ErrUploadSessionNotFound
+	}
+	return UploadSession{}, ErrUploadSessionState
+}
+
+// จอง session ไว้ตรวจไฟล์ ถ้าตรวจไม่ผ่านให้ ReleaseUploadSession เพื่อให้ลองใหม่ได้
+func ClaimUploadSession(ctx context.Context, id, userID primitive.ObjectID) (UploadSession, error) {
+	return transitionUploadSession(ctx, id, userID, UploadSessionOpen, UploadSessionFinalizing, nil)
+}
+
+func ReleaseUploadSession(ctx context.Context, id, userID primitive.ObjectID) error {
+	_, err := transitionUploadSession(ctx, id, userID, UploadSessionFinalizing, UploadSessionOpen, nil)
+	return err
+}
+
+// บันทึกรูปที่ตรวจแล้ว รอผูกกับสินค้าภายใน keepFor
+func CompleteUploadSession(ctx context.Context, id, userID primitive.ObjectID, images []ImageVariant, keepFor time.Duration) error {
+	_, err := transitionUploadSession(ctx, id, userID, UploadSessionFinalizing, UploadSessionFinalized, bson.M{
+		"images":     images,
+		"expires_at": time.Now().Add(keepFor),
+	})
+	return err
+}
+
+// ใช้รูปของ session ที่ finalize แล้วกับสินค้า ใช้ได้ครั้งเดียว
+func AttachUploadSession(ctx context.Context, id, userID primitive.ObjectID) (UploadSession, error) {
+	return transitionUploadSession(ctx, id, userID, UploadSessionFinalized, UploadSessionAttached, nil)
+}
+
+// ผูกกับสินค้าไม่สำเร็จ คืน session เป็น finalized ให้ใช้ใหม่ได้
+func DetachUploadSession(ctx context.Context, id, userID primitive.ObjectID) error {
+	_, err := transitionUploadSession(ctx, id, userID, UploadSessionAttached, UploadSessionFinalized, nil)
+	return err
+}
@@ -1,6 +1,10 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type User struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
@@ -13,6 +17,11 @@ type User struct {
 	Addresses    []Address          `json:"addresses" bson:"addresses"`
 	SellerInfo   *SellerInfo        `json:"seller_info,omitempty" bson:"seller_info,omitempty"`
 	IsSeller     bool               `json:"is_seller" bson:"is_seller"`
+	Roles        []string           `json:"roles" bson:"roles,omitempty"` // buyer, seller, moderator, admin
+	TwoFactor    *TwoFactor         `json:"-" bson:"two_factor,omitempty"`
+	TwoFactorOn  bool               `json:"two_factor_enabled" bson:"-"` // ใช้ตอบกลับเท่านั้น
+	// token ที่ออกก่อนเวลานี้ใช้ไม่ได้ (เช่น หลังตั้งรหัสผ่านใหม่)
+	SessionsRevokedAt time.Time `json:"-" bson:"sessions_revoked_at,omitempty"`
 }
 type SellerInfo struct {
 	FirstName         string `json:"first_name" bson:"first_name"`
@@ -21,7 +30,8 @@ type SellerInfo struct {
 	BankName          string `json:"bank_name" bson:"bank_name"`
 	BankAccountNumber string `json:"bank_account_number" bson:"bank_account_number"`
 	CitizenID         string `json:"citizen_id" bson:"citizen_id"`
-	IDCardImageURL    string `json:"id_card_image_url" bson:"id_card_image_url"`
+	IDCardImageKey    string `json:"-" bson:"id_card_image_key,omitempty"`    // key ใน private storage ดูได้เฉพาะ admin ผ่าน signed URL
+	IDCardImageURL    string `json:"-" bson:"id_card_image_url,omitempty"`    // URL สาธารณะแบบเก่า ย้ายไป private ด้วย MigrateIDCardImages
 	IsVerified        bool   `json:"is_verified" bson:"is_verified"`
 	RecipientID       string `json:"recipient_id,omitempty" bson:"recipient_id,omitempty"`
 	Rating            float64 `json:"rating" bson:"rating"`
@@ -0,0 +1,181 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeProvider จำลอง Omise ในหน่วยความจำ ใช้ตอน dev/test ที่ไม่มี key จริง
+// ID ที่สร้างเป็นเลขเรียงต่อกัน จึงคาดเดาผลลัพธ์ได้ทุกครั้ง
+type FakeProvider struct {
+	mu         sync.Mutex
+	seq        int
+	Charges    map[string]*Charge
+	Transfers  []Transfer
+	Refunds    []Refund
+	Recipients map[string]BankAccount
+
+	// ตั้งค่าเพื่อจำลองความผิดพลาดของแต่ละ operation
+	FailTransfer error
+	FailRefund   error
+}
+
+func NewFake() *FakeProvider {
+	return &FakeProvider{
+		Charges:    make(map[string]*Charge),
+		Recipients: make(map[string]BankAccount),
+	}
+}
+
+func (f *FakeProvider) nextID(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_fake_%04d", prefix, f.seq)
+}
+
+func (f *FakeProvider) CreatePromptPaySource(ctx context.Context, amount int64) (*Source, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.nextID("src")
+	return &Source{
+		ID:         id,
+		Amount:     amount,
+		QRImageURL: "https://cdn.omise.co/scannable_code/test_qr.png",
+	}, nil
+}
+
+func (f *FakeProvider) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	charge := &Charge{
+		ID:       f.nextID("chrg"),
+		SourceID: req.SourceID,
+		Amount:   req.Amount,
+		Status:   "pending",
+	}
+	// จ่ายด้วยบัตรถือว่าสำเร็จทันที
+	if req.CardToken != "" {
+		charge.Status = "successful"
+		charge.Paid = true
+	}
+	f.Charges[charge.ID] = charge
+
+	result := *charge
+	return &result, nil
+}
+
+func (f *FakeProvider) RetrieveCharge(ctx context.Context, chargeID string) (*Charge, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	charge, ok := f.Charges[chargeID]
+	if !ok {
+		return nil, ErrChargeNotFound
+	}
+	result := *charge
+	return &result, nil
+}
+
+func (f *FakeProvider) MarkChargePaid(ctx context.Context, chargeID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	charge, ok := f.Charges[chargeID]
+	if !ok {
+		return ErrChargeNotFound
+	}
+	charge.Status = "successful"
+	charge.Paid = true
+	return nil
+}
+
+func (f *FakeProvider) CreateRecipient(ctx context.Context, name string, account BankAccount) (*Recipient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.nextID("recp")
+	f.Recipients[id] = account
+	return &Recipient{ID: id}, nil
+}
+
+func (f *FakeProvider) CreateTransfer(ctx context.Context, req TransferRequest) (*Transfer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.FailTransfer != nil {
+		return nil, f.FailTransfer
+	}
+	// reference เดิมคืนรายการโอนเดิม เหมือน idempotency key ของ Omise
+	if req.Reference != "" {
+		for _, t := range f.Transfers {
+			if t.Reference == req.Reference {
+				return &t, nil
+			}
+		}
+	}
+	transfer := Transfer{
+		ID:          f.nextID("trsf"),
+		RecipientID: req.RecipientID,
+		Amount:      req.Amount,
+		Paid:        true,
+		Reference:   req.Reference,
+		CreatedAt:   time.Now(),
+	}
+	f.Transfers = append(f.Transfers, transfer)
+	return &transfer, nil
+}
+
+func (f *FakeProvider) ListTransfers(ctx context.Context, since time.Time) ([]Transfer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []Transfer
+	for _, t := range f.Transfers {
+		if !t.CreatedAt.Before(since) {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeProvider) CreateRefund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.FailRefund != nil {
+		return nil, f.FailRefund
+	}
+	// จำลอง idempotency key ของ Omise ส่ง reference เดิมซ้ำจะได้ refund เดิม
+	if req.Reference != "" {
+		for _, r := range f.Refunds {
+			if r.Reference == req.Reference {
+				refund := r
+				return &refund, nil
+			}
+		}
+	}
+	refund := Refund{
+		ID:        f.nextID("rfnd"),
+		ChargeID:  req.ChargeID,
+		Amount:    req.Amount,
+		Reference: req.Reference,
+	}
+	f.Refunds = append(f.Refunds, refund)
+	return &refund, nil
+}
+
+func (f *FakeProvider) ListRefunds(ctx context.Context, chargeID string) ([]Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []Refund
+	for _, r := range f.Refunds {
+		if r.ChargeID == chargeID {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
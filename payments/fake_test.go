@@ -0,0 +1,158 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// FakeProvider ต้องใช้แทน Provider ได้
+var _ Provider = (*FakeProvider)(nil)
+
+func TestFakeChargeLifecycle(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name       string
+		req        ChargeRequest
+		wantStatus string
+		wantPaid   bool
+	}{
+		{"promptpay waits for payment", ChargeRequest{Amount: 125000, SourceID: "src_fake_0001"}, ChargePending, false},
+		{"card is paid immediately", ChargeRequest{Amount: 125000, CardToken: "tokn_test"}, ChargeSuccessful, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := NewFake()
+			charge, err := fake.CreateCharge(ctx, tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if charge.Status != tc.wantStatus || charge.Paid != tc.wantPaid {
+				t.Fatalf("charge = %+v, want status %s paid %v", charge, tc.wantStatus, tc.wantPaid)
+			}
+
+			if err := fake.MarkChargePaid(ctx, charge.ID); err != nil {
+				t.Fatal(err)
+			}
+			got, err := fake.RetrieveCharge(ctx, charge.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != ChargeSuccessful || !got.Paid || got.Amount != tc.req.Amount || got.SourceID != tc.req.SourceID {
+				t.Fatalf("retrieved charge = %+v", got)
+			}
+		})
+	}
+}
+
+func TestFakeUnknownCharge(t *testing.T) {
+	fake := NewFake()
+	ctx := context.Background()
+	if _, err := fake.RetrieveCharge(ctx, "chrg_missing"); !errors.Is(err, ErrChargeNotFound) {
+		t.Errorf("RetrieveCharge error = %v, want ErrChargeNotFound", err)
+	}
+	if err := fake.MarkChargePaid(ctx, "chrg_missing"); !errors.Is(err, ErrChargeNotFound) {
+		t.Errorf("MarkChargePaid error = %v, want ErrChargeNotFound", err)
+	}
+}
+
+// คืน copy ไม่ใช่ pointer ภายใน แก้ค่าที่ได้แล้วต้องไม่กระทบ state ของ fake
+func TestFakeRetrieveChargeReturnsCopy(t *testing.T) {
+	fake := NewFake()
+	ctx := context.Background()
+	charge, _ := fake.CreateCharge(ctx, ChargeRequest{Amount: 100})
+	charge.Status = ChargeSuccessful
+
+	got, _ := fake.RetrieveCharge(ctx, charge.ID)
+	if got.Status != ChargePending {
+		t.Fatalf("status = %s, want %s", got.Status, ChargePending)
+	}
+}
+
+func TestFakeTransferIdempotency(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name       string
+		references []string
+		want       int
+	}{
+		{"same reference is one transfer", []string{"payout_1", "payout_1"}, 1},
+		{"new round is a new transfer", []string{"payout_1", "payout_1:1"}, 2},
+		{"no reference is never deduplicated", []string{"", ""}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := NewFake()
+			ids := map[string]bool{}
+			for _, ref := range tc.references {
+				transfer, err := fake.CreateTransfer(ctx, TransferRequest{Amount: 5000, RecipientID: "recp_fake_0001", Reference: ref})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids[transfer.ID] = true
+			}
+			if len(ids) != tc.want || len(fake.Transfers) != tc.want {
+				t.Fatalf("transfers = %d (ids %d), want %d", len(fake.Transfers), len(ids), tc.want)
+			}
+		})
+	}
+}
+
+func TestFakeTransferFailure(t *testing.T) {
+	fake := NewFake()
+	fake.FailTransfer = errors.New("insufficient balance")
+	if _, err := fake.CreateTransfer(context.Background(), TransferRequest{Amount: 5000, Reference: "payout_1"}); err != fake.FailTransfer {
+		t.Fatalf("error = %v, want %v", err, fake.FailTransfer)
+	}
+	if len(fake.Transfers) != 0 {
+		t.Fatalf("transfers = %d, want 0", len(fake.Transfers))
+	}
+}
+
+func TestFakeListTransfersSince(t *testing.T) {
+	fake := NewFake()
+	now := time.Now()
+	fake.Transfers = []Transfer{
+		{ID: "old", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "new", CreatedAt: now.Add(-time.Minute)},
+	}
+	got, err := fake.ListTransfers(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "new" {
+		t.Fatalf("ListTransfers = %+v, want only new", got)
+	}
+}
+
+func TestFakeRefunds(t *testing.T) {
+	fake := NewFake()
+	ctx := context.Background()
+
+	first, err := fake.CreateRefund(ctx, RefundRequest{ChargeID: "chrg_a", Amount: 125000, Reference: "refund_order1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := fake.CreateRefund(ctx, RefundRequest{ChargeID: "chrg_a", Amount: 125000, Reference: "refund_order1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Fatalf("same reference created a second refund: %s and %s", first.ID, again.ID)
+	}
+	if _, err := fake.CreateRefund(ctx, RefundRequest{ChargeID: "chrg_b", Amount: 500, Reference: "refund_order2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	refunds, err := fake.ListRefunds(ctx, "chrg_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refunds) != 1 || refunds[0].Reference != "refund_order1" || refunds[0].Amount != 125000 {
+		t.Fatalf("ListRefunds(chrg_a) = %+v", refunds)
+	}
+
+	fake.FailRefund = errors.New("charge already refunded")
+	if _, err := fake.CreateRefund(ctx, RefundRequest{ChargeID: "chrg_c", Amount: 1, Reference: "refund_order3"}); err != fake.FailRefund {
+		t.Fatalf("error = %v, want %v", err, fake.FailRefund)
+	}
+}
@@ -0,0 +1,275 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/omise/omise-go"
+	"github.com/omise/omise-go/operations"
+)
+
+type OmiseProvider struct {
+	publicKey string
+	secretKey string
+}
+
+func NewOmise(publicKey, secretKey string) (*OmiseProvider, error) {
+	// ตรวจรูปแบบ key ตั้งแต่ตอนเริ่ม server
+	if _, err := omise.NewClient(publicKey, secretKey); err != nil {
+		return nil, fmt.Errorf("omise client init failed: %v", err)
+	}
+	return &OmiseProvider{publicKey: publicKey, secretKey: secretKey}, nil
+}
+
+// omise.Client เก็บ context ไว้ในตัว จึงสร้างใหม่ทุกครั้งเพื่อให้ใช้พร้อมกันหลาย request ได้
+func (p *OmiseProvider) client(ctx context.Context) (*omise.Client, error) {
+	client, err := omise.NewClient(p.publicKey, p.secretKey)
+	if err != nil {
+		return nil, err
+	}
+	client.WithContext(ctx)
+	return client, nil
+}
+
+func (p *OmiseProvider) CreatePromptPaySource(ctx context.Context, amount int64) (*Source, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &omise.Source{}
+	if err := client.Do(source, &operations.CreateSource{
+		Type:     "promptpay",
+		Amount:   amount,
+		Currency: "thb",
+	}); err != nil {
+		return nil, err
+	}
+
+	result := &Source{ID: source.ID, Amount: source.Amount}
+	if source.ScannableCode != nil && source.ScannableCode.Image != nil {
+		result.QRImageURL = source.ScannableCode.Image.DownloadURI
+	}
+	return result, nil
+}
+
+func (p *OmiseProvider) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = "thb"
+	}
+
+	charge := &omise.Charge{}
+	if err := client.Do(charge, &operations.CreateCharge{
+		Amount:   req.Amount,
+		Currency: currency,
+		Source:   req.SourceID,
+		Card:     req.CardToken,
+	}); err != nil {
+		return nil, err
+	}
+
+	result := &Charge{
+		ID:     charge.ID,
+		Amount: charge.Amount,
+		Status: string(charge.Status),
+		Paid:   charge.Paid,
+	}
+	if charge.Source != nil {
+		result.SourceID = charge.Source.ID
+	}
+	return result, nil
+}
+
+func (p *OmiseProvider) RetrieveCharge(ctx context.Context, chargeID string) (*Charge, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	charge := &omise.Charge{}
+	if err := client.Do(charge, &operations.RetrieveCharge{ChargeID: chargeID}); err != nil {
+		var omiseErr *omise.Error
+		if errors.As(err, &omiseErr) && omiseErr.StatusCode == http.StatusNotFound {
+			return nil, ErrChargeNotFound
+		}
+		return nil, err
+	}
+	result := &Charge{ID: charge.ID, Amount: charge.Amount, Status: string(charge.Status), Paid: charge.Paid}
+	if charge.Source != nil {
+		result.SourceID = charge.Source.ID
+	}
+	return result, nil
+}
+
+// omise-go ไม่มี operation สำหรับ mark_as_paid จึงเรียก API ตรง
+func (p *OmiseProvider) MarkChargePaid(ctx context.Context, chargeID string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.omise.co/charges/"+chargeID+"/mark_as_paid", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.secretKey, "")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("omise mark_as_paid returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (p *OmiseProvider) CreateRecipient(ctx context.Context, name string, account BankAccount) (*Recipient, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient := &omise.Recipient{}
+	if err := client.Do(recipient, &operations.CreateRecipient{
+		Name: name,
+		Type: "individual",
+		BankAccount: &omise.BankAccountRequest{
+			Brand:  account.Brand,
+			Number: account.Number,
+			Name:   account.Name,
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return &Recipient{ID: recipient.ID}, nil
+}
+
+func (p *OmiseProvider) CreateTransfer(ctx context.Context, req TransferRequest) (*Transfer, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &operations.CreateTransfer{
+		Amount:    req.Amount,
+		Recipient: req.RecipientID,
+	}
+	if req.Reference != "" {
+		op.IdempKey = req.Reference
+		op.Metadata = map[string]interface{}{"reference": req.Reference}
+	}
+
+	transfer := &omise.Transfer{}
+	if err := client.Do(transfer, op); err != nil {
+		return nil, err
+	}
+	result := toTransfer(transfer)
+	return &result, nil
+}
+
+func (p *OmiseProvider) ListTransfers(ctx context.Context, since time.Time) ([]Transfer, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	const pageSize = 100
+	var transfers []Transfer
+	for offset := 0; ; offset += pageSize {
+		list := &omise.TransferList{}
+		if err := client.Do(list, &operations.ListTransfers{
+			List: operations.List{From: since, Offset: offset, Limit: pageSize},
+		}); err != nil {
+			return nil, err
+		}
+		for _, t := range list.Data {
+			transfers = append(transfers, toTransfer(t))
+		}
+		if len(list.Data) < pageSize {
+			return transfers, nil
+		}
+	}
+}
+
+func toTransfer(t *omise.Transfer) Transfer {
+	result := Transfer{
+		ID:          t.ID,
+		RecipientID: t.Recipient,
+		Amount:      t.Amount,
+		Paid:        t.Paid,
+		CreatedAt:   t.CreatedAt,
+	}
+	if t.FailureMessage != nil {
+		result.FailureMessage = *t.FailureMessage
+	}
+	if ref, ok := t.Metadata["reference"].(string); ok {
+		result.Reference = ref
+	}
+	return result
+}
+
+func (p *OmiseProvider) CreateRefund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &operations.CreateRefund{
+		ChargeID: req.ChargeID,
+		Amount:   req.Amount,
+	}
+	if req.Reference != "" {
+		// API refund ไม่มี idemp_key ใน body ต้องส่งผ่าน header แทน
+		client.WithCustomHeaders(map[string]string{"Idempotency-Key": req.Reference})
+		op.Metadata = map[string]interface{}{"reference": req.Reference}
+	}
+
+	refund := &omise.Refund{}
+	if err := client.Do(refund, op); err != nil {
+		return nil, err
+	}
+	result := toRefund(refund)
+	return &result, nil
+}
+
+func (p *OmiseProvider) ListRefunds(ctx context.Context, chargeID string) ([]Refund, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	const pageSize = 100
+	var refunds []Refund
+	for offset := 0; ; offset += pageSize {
+		list := &omise.RefundList{}
+		if err := client.Do(list, &operations.ListRefunds{
+			ChargeID: chargeID,
+			List:     operations.List{Offset: offset, Limit: pageSize},
+		}); err != nil {
+			return nil, err
+		}
+		for _, r := range list.Data {
+			refunds = append(refunds, toRefund(r))
+		}
+		if len(list.Data) < pageSize {
+			return refunds, nil
+		}
+	}
+}
+
+func toRefund(r *omise.Refund) Refund {
+	result := Refund{ID: r.ID, ChargeID: r.Charge, Amount: r.Amount}
+	if ref, ok := r.Metadata["reference"].(string); ok {
+		result.Reference = ref
+	}
+	return result
+}
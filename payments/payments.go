@@ -0,0 +1,103 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// จำนวนเงินทั้งหมดในแพ็กเกจนี้เป็นหน่วยสตางค์ (1 บาท = 100)
+
+type Source struct {
+	ID         string
+	Amount     int64
+	QRImageURL string
+}
+
+type ChargeRequest struct {
+	Amount    int64
+	Currency  string
+	SourceID  string // จ่ายผ่าน source เช่น PromptPay
+	CardToken string // หรือจ่ายผ่านบัตร
+}
+
+type Charge struct {
+	ID       string
+	SourceID string
+	Amount   int64
+	Status   string // pending, successful, failed, expired หรือ reversed
+	Paid     bool
+}
+
+const (
+	ChargePending    = "pending"
+	ChargeSuccessful = "successful"
+	ChargeFailed     = "failed"
+	ChargeExpired    = "expired"
+	ChargeReversed   = "reversed"
+)
+
+type BankAccount struct {
+	Brand  string // รหัสธนาคารตาม Omise เช่น kbank, scb
+	Number string
+	Name   string
+}
+
+type Recipient struct {
+	ID string
+}
+
+type TransferRequest struct {
+	Amount      int64
+	RecipientID string
+	Reference   string // ID ของรายการโอนฝั่งเรา ใช้เป็น idempotency key และเก็บใน metadata
+}
+
+type Transfer struct {
+	ID             string
+	RecipientID    string
+	Amount         int64
+	Paid           bool
+	Reference      string
+	FailureMessage string
+	CreatedAt      time.Time
+}
+
+type RefundRequest struct {
+	ChargeID  string
+	Amount    int64
+	Reference string // ID ของรายการคืนเงินฝั่งเรา ใช้เป็น idempotency key และเก็บใน metadata
+}
+
+type Refund struct {
+	ID        string
+	ChargeID  string
+	Amount    int64
+	Reference string
+}
+
+// Provider คือช่องทางรับ/จ่ายเงินที่ controllers เรียกใช้
+type Provider interface {
+	CreatePromptPaySource(ctx context.Context, amount int64) (*Source, error)
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	RetrieveCharge(ctx context.Context, chargeID string) (*Charge, error) // ErrChargeNotFound ถ้าไม่มี charge นี้
+	MarkChargePaid(ctx context.Context, chargeID string) error            // ใช้ได้เฉพาะ test mode
+	CreateRecipient(ctx context.Context, name string, account BankAccount) (*Recipient, error)
+	CreateTransfer(ctx context.Context, req TransferRequest) (*Transfer, error)
+	ListTransfers(ctx context.Context, since time.Time) ([]Transfer, error)
+	CreateRefund(ctx context.Context, req RefundRequest) (*Refund, error)
+	ListRefunds(ctx context.Context, chargeID string) ([]Refund, error)
+}
+
+var ErrChargeNotFound = errors.New("payments: charge not found")
+
+// เลือก provider จาก PAYMENT_PROVIDER (omise หรือ fake) ค่าเริ่มต้นคือ omise
+func NewFromEnv() (Provider, error) {
+	switch os.Getenv("PAYMENT_PROVIDER") {
+	case "fake":
+		return NewFake(), nil
+	default:
+		return NewOmise(os.Getenv("OMISE_PUBLIC_KEY"), os.Getenv("OMISE_SECRET_KEY"))
+	}
+}
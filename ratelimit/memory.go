@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	hits    []time.Time
+	expires time.Time
+}
+
+// MemoryStore เก็บในหน่วยความจำของ process ใช้ได้เมื่อรัน server instance เดียว
+type MemoryStore struct {
+	mu    sync.Mutex
+	hits  map[string]*memoryEntry
+	locks map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		hits:  map[string]*memoryEntry{},
+		locks: map[string]time.Time{},
+	}
+	go s.janitor(time.Minute)
+	return s
+}
+
+func (s *MemoryStore) Count(_ context.Context, key string, since time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hits := s.trim(key, since)
+	if len(hits) == 0 {
+		return 0, time.Time{}, nil
+	}
+	return len(hits), hits[0], nil
+}
+
+func (s *MemoryStore) Add(_ context.Context, key string, at time.Time, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(key, at, ttl)
+	return nil
+}
+
+// นับและบันทึกภายใต้ lock เดียวกัน request พร้อมกันจึงผ่านได้ไม่เกิน Limit
+func (s *MemoryStore) Take(_ context.Context, key string, rule Rule, now time.Time) (bool, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hits := s.trim(key, now.Add(-rule.Window))
+	if len(hits) >= rule.Limit {
+		return false, hits[0].Add(rule.Window), nil
+	}
+	s.add(key, now, rule.Window)
+	return true, time.Time{}, nil
+}
+
+// ตัด hit ที่เก่ากว่า since ทิ้งแล้วคืน hit ที่เหลือ (ต้องถือ s.mu อยู่)
+func (s *MemoryStore) trim(key string, since time.Time) []time.Time {
+	entry, ok := s.hits[key]
+	if !ok {
+		return nil
+	}
+	// hit เรียงตามเวลา
+	i := 0
+	for i < len(entry.hits) && entry.hits[i].Before(since) {
+		i++
+	}
+	entry.hits = entry.hits[i:]
+	return entry.hits
+}
+
+// ต้องถือ s.mu อยู่
+func (s *MemoryStore) add(key string, at time.Time, ttl time.Duration) {
+	entry, ok := s.hits[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.hits[key] = entry
+	}
+	entry.hits = append(entry.hits, at)
+	if expires := at.Add(ttl); expires.After(entry.expires) {
+		entry.expires = expires
+	}
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.hits, key)
+	return nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = until
+	return nil
+}
+
+func (s *MemoryStore) LockedUntil(_ context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.locks[key]
+	if !ok || !until.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// ลบ key ที่หมดอายุเป็นระยะ ไม่ให้ map โตไม่สิ้นสุด
+func (s *MemoryStore) janitor(every time.Duration) {
+	for range time.Tick(every) {
+		now := time.Now()
+		s.mu.Lock()
+		for key, entry := range s.hits {
+			if entry.expires.Before(now) {
+				delete(s.hits, key)
+			}
+		}
+		for key, until := range s.locks {
+			if until.Before(now) {
+				delete(s.locks, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
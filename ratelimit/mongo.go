@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"arttoy-hub/database"
+	"context"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore ใช้ร่วมกันได้หลาย instance เอกสารหมดอายุเองด้วย TTL index
+type MongoStore struct {
+	hits     *mongo.Collection
+	counters *mongo.Collection
+	locks    *mongo.Collection
+}
+
+func NewMongoStore() *MongoStore {
+	return &MongoStore{
+		hits:     db.OpenCollection("rate_limit_hits"),
+		counters: db.OpenCollection("rate_limit_counters"),
+		locks:    db.OpenCollection("rate_limit_locks"),
+	}
+}
+
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.hits.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "at", Value: 1}}},
+		{Keys: bson.D{{Key: "expire_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.counters.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.locks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "until", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoStore) Count(ctx context.Context, key string, since time.Time) (int, time.Time, error) {
+	cursor, err := s.hits.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"key": key, "at": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "count": bson.M{"$sum": 1}, "oldest": bson.M{"$min": "$at"}}}},
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Count  int       `bson:"count"`
+		Oldest time.Time `bson:"oldest"`
+	}
+	if err := cursor.All(ctx, &result); err != nil || len(result) == 0 {
+		return 0, time.Time{}, err
+	}
+	return result[0].Count, result[0].Oldest, nil
+}
+
+func (s *MongoStore) Add(ctx context.Context, key string, at time.Time, ttl time.Duration) error {
+	_, err := s.hits.InsertOne(ctx, bson.M{"key": key, "at": at, "expire_at": at.Add(ttl)})
+	return err
+}
+
+// ใช้ counter หนึ่งเอกสารต่อ window (fixed window) แล้ว $inc ใน operation เดียว
+// instance ไหนยิงพร้อมกันก็ได้ค่า count ไม่ซ้ำกัน จึงผ่านได้ไม่เกิน Limit
+func (s *MongoStore) Take(ctx context.Context, key string, rule Rule, now time.Time) (bool, time.Time, error) {
+	windowStart := now.Truncate(rule.Window)
+	windowEnd := windowStart.Add(rule.Window)
+
+	var counter struct {
+		Count int `bson:"count"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": key + ":" + strconv.FormatInt(windowStart.Unix(), 10)},
+		bson.M{
+			"$inc":         bson.M{"count": 1},
+			"$setOnInsert": bson.M{"key": key, "expire_at": windowEnd},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if counter.Count > rule.Limit {
+		return false, windowEnd, nil
+	}
+	return true, time.Time{}, nil
+}
+
+func (s *MongoStore) Reset(ctx context.Context, key string) error {
+	_, err := s.hits.DeleteMany(ctx, bson.M{"key": key})
+	return err
+}
+
+func (s *MongoStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.locks.UpdateByID(ctx, key, bson.M{"$set": bson.M{"until": until}}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var lock struct {
+		Until time.Time `bson:"until"`
+	}
+	err := s.locks.FindOne(ctx, bson.M{"_id": key, "until": bson.M{"$gt": time.Now()}}).Decode(&lock)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	return lock.Until, err
+}
@@ -0,0 +1,202 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule จำกัดไม่เกิน Limit ครั้งภายใน Window (MemoryStore นับแบบ sliding, MongoStore แบบ fixed window) Limit <= 0 = ไม่จำกัด
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Scope กติกาของกลุ่ม endpoint หนึ่ง นับแยกต่อ IP และต่อ identifier (เช่น เบอร์โทร, อีเมล)
+type Scope struct {
+	PerIP Rule
+	PerID Rule
+}
+
+// Lockout ล็อกชั่วคราวเมื่อ login ผิดครบ MaxFailures ครั้งภายใน Window
+type Lockout struct {
+	MaxFailures int
+	Window      time.Duration
+	Duration    time.Duration
+}
+
+type Config struct {
+	Scopes  map[string]Scope
+	Lockout Lockout
+}
+
+// Store ที่เก็บประวัติการเรียก ใช้ในหน่วยความจำ (instance เดียว) หรือ Mongo (หลาย instance)
+type Store interface {
+	// จำนวน hit ของ key ตั้งแต่ since และเวลาของ hit ที่เก่าที่สุด
+	Count(ctx context.Context, key string, since time.Time) (int, time.Time, error)
+	// บันทึก hit เก็บไว้อย่างน้อย ttl
+	Add(ctx context.Context, key string, at time.Time, ttl time.Duration) error
+	// ตรวจและบันทึก hit ในขั้นเดียว (atomic) ถ้าเกิน rule คืน false พร้อมเวลาที่เรียกได้อีกครั้ง
+	Take(ctx context.Context, key string, rule Rule, now time.Time) (bool, time.Time, error)
+	Reset(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, until time.Time) error
+	// เวลาที่ key ถูกล็อกถึง (zero = ไม่ได้ล็อก)
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+}
+
+type Limiter struct {
+	Store  Store
+	Config Config
+}
+
+// Allow ตรวจและบันทึกการเรียกหนึ่งครั้ง คืนเวลาที่ต้องรอถ้าเกินกำหนด (0 = ผ่าน)
+func (l *Limiter) Allow(ctx context.Context, key string, rule Rule) (time.Duration, error) {
+	if rule.Limit <= 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	ok, retryAt, err := l.Store.Take(ctx, key, rule, now)
+	if err != nil || ok {
+		return 0, err
+	}
+	return waitUntil(retryAt, now), nil
+}
+
+// LockedFor เวลาที่เหลือของการล็อก (0 = ไม่ได้ล็อก)
+func (l *Limiter) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	until, err := l.Store.LockedUntil(ctx, key)
+	if err != nil || until.IsZero() {
+		return 0, err
+	}
+	return waitUntil(until, time.Now()), nil
+}
+
+// RecordFailure บันทึกการ login ผิด และล็อก key เมื่อผิดครบกำหนด คืนเวลาล็อกถ้าเพิ่งถูกล็อก
+func (l *Limiter) RecordFailure(ctx context.Context, key string) (time.Duration, error) {
+	lockout := l.Config.Lockout
+	if lockout.MaxFailures <= 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	failKey := key + ":fail"
+	if err := l.Store.Add(ctx, failKey, now, lockout.Window); err != nil {
+		return 0, err
+	}
+	count, _, err := l.Store.Count(ctx, failKey, now.Add(-lockout.Window))
+	if err != nil || count < lockout.MaxFailures {
+		return 0, err
+	}
+	if err := l.Store.Lock(ctx, key, now.Add(lockout.Duration)); err != nil {
+		return 0, err
+	}
+	return lockout.Duration, l.Store.Reset(ctx, failKey)
+}
+
+// RecordSuccess ล้างจำนวนครั้งที่ผิดหลัง login สำเร็จ
+func (l *Limiter) RecordSuccess(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key+":fail")
+}
+
+func waitUntil(t, now time.Time) time.Duration {
+	if wait := t.Sub(now); wait > time.Second {
+		return wait
+	}
+	return time.Second
+}
+
+// ParseRule อ่านรูปแบบ "10/15m" (10 ครั้งต่อ 15 นาที) ค่า "off" หรือ "0" = ไม่จำกัด
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" || s == "0" {
+		return Rule{}, nil
+	}
+	limitStr, windowStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rate limit %q, want <limit>/<window> e.g. 10/15m", s)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: bad limit", s)
+	}
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: bad window", s)
+	}
+	return Rule{Limit: limit, Window: window}, nil
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Scopes: map[string]Scope{
+			"login":    {PerIP: Rule{30, 15 * time.Minute}, PerID: Rule{10, 15 * time.Minute}},
+			"register": {PerIP: Rule{10, time.Hour}, PerID: Rule{5, time.Hour}},
+			"password": {PerIP: Rule{10, time.Hour}, PerID: Rule{5, time.Hour}},
+		},
+		Lockout: Lockout{MaxFailures: 5, Window: 15 * time.Minute, Duration: 15 * time.Minute},
+	}
+}
+
+// LoadConfig ค่าเริ่มต้นจาก DefaultConfig แก้ได้ด้วย env RATE_LIMIT_<SCOPE>_IP / RATE_LIMIT_<SCOPE>_ID
+// และ LOGIN_LOCKOUT (เช่น 5/15m) กับ LOGIN_LOCKOUT_DURATION (เช่น 15m)
+func LoadConfig() (Config, error) {
+	cfg := DefaultConfig()
+	for name, scope := range cfg.Scopes {
+		prefix := "RATE_LIMIT_" + strings.ToUpper(name)
+		if v := os.Getenv(prefix + "_IP"); v != "" {
+			rule, err := ParseRule(v)
+			if err != nil {
+				return cfg, fmt.Errorf("%s_IP: %w", prefix, err)
+			}
+			scope.PerIP = rule
+		}
+		if v := os.Getenv(prefix + "_ID"); v != "" {
+			rule, err := ParseRule(v)
+			if err != nil {
+				return cfg, fmt.Errorf("%s_ID: %w", prefix, err)
+			}
+			scope.PerID = rule
+		}
+		cfg.Scopes[name] = scope
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT"); v != "" {
+		rule, err := ParseRule(v)
+		if err != nil {
+			return cfg, fmt.Errorf("LOGIN_LOCKOUT: %w", err)
+		}
+		cfg.Lockout.MaxFailures = rule.Limit
+		cfg.Lockout.Window = rule.Window
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("LOGIN_LOCKOUT_DURATION: invalid duration %q", v)
+		}
+		cfg.Lockout.Duration = d
+	}
+	return cfg, nil
+}
+
+// NewFromEnv เลือก store ตาม RATE_LIMIT_STORE (memory หรือ mongo) และโหลดกติกาจาก env
+func NewFromEnv(ctx context.Context) (*Limiter, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	var store Store
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "mongo":
+		mongoStore := NewMongoStore()
+		if err := mongoStore.EnsureIndexes(ctx); err != nil {
+			return nil, err
+		}
+		store = mongoStore
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", os.Getenv("RATE_LIMIT_STORE"))
+	}
+	return &Limiter{Store: store, Config: cfg}, nil
+}
@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	for in, want := range map[string]Rule{
+		"10/15m":  {10, 15 * time.Minute},
+		" 5/1h ":  {5, time.Hour},
+		"1/30s":   {1, 30 * time.Second},
+		"off":     {},
+		"0":       {},
+		"0/1m":    {0, time.Minute},
+		"100/24h": {100, 24 * time.Hour},
+	} {
+		got, err := ParseRule(in)
+		if err != nil || got != want {
+			t.Errorf("ParseRule(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+}
+
+func TestParseRuleRejectsInvalid(t *testing.T) {
+	for _, in := range []string{"", "10", "10/", "/15m", "-1/15m", "ten/15m", "10/0s", "10/-1m", "10/abc"} {
+		if got, err := ParseRule(in); err == nil {
+			t.Errorf("ParseRule(%q) = %v, want error", in, got)
+		}
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT_LOGIN_IP", "50/1h")
+	t.Setenv("RATE_LIMIT_REGISTER_ID", "off")
+	t.Setenv("LOGIN_LOCKOUT", "3/10m")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "30m")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Scopes["login"].PerIP; got != (Rule{50, time.Hour}) {
+		t.Errorf("login PerIP = %v", got)
+	}
+	if got := cfg.Scopes["login"].PerID; got != DefaultConfig().Scopes["login"].PerID {
+		t.Errorf("login PerID = %v, want default", got)
+	}
+	if got := cfg.Scopes["register"].PerID; got.Limit != 0 {
+		t.Errorf("register PerID = %v, want off", got)
+	}
+	if want := (Lockout{MaxFailures: 3, Window: 10 * time.Minute, Duration: 30 * time.Minute}); cfg.Lockout != want {
+		t.Errorf("Lockout = %+v, want %+v", cfg.Lockout, want)
+	}
+
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "soon")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig accepted invalid LOGIN_LOCKOUT_DURATION")
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name    string
+		rule    Rule
+		calls   int
+		allowed int
+	}{
+		{"under limit", Rule{5, time.Minute}, 3, 3},
+		{"at limit", Rule{3, time.Minute}, 3, 3},
+		{"over limit", Rule{3, time.Minute}, 10, 3},
+		{"unlimited", Rule{0, time.Minute}, 100, 100},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := &Limiter{Store: NewMemoryStore(), Config: DefaultConfig()}
+			allowed := 0
+			for i := 0; i < tc.calls; i++ {
+				wait, err := l.Allow(ctx, "login:ip:1.2.3.4", tc.rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if wait == 0 {
+					allowed++
+				} else if wait > tc.rule.Window {
+					t.Fatalf("wait = %v, longer than window %v", wait, tc.rule.Window)
+				}
+			}
+			if allowed != tc.allowed {
+				t.Fatalf("allowed = %d, want %d", allowed, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{Store: NewMemoryStore(), Config: DefaultConfig()}
+	rule := Rule{1, time.Minute}
+	for _, key := range []string{"login:ip:1.1.1.1", "login:ip:2.2.2.2", "login:id:alice"} {
+		if wait, _ := l.Allow(ctx, key, rule); wait != 0 {
+			t.Errorf("first call for %s was limited", key)
+		}
+	}
+	if wait, _ := l.Allow(ctx, "login:ip:1.1.1.1", rule); wait == 0 {
+		t.Error("second call for the same key was allowed")
+	}
+}
+
+// MemoryStore นับแบบ sliding window: hit เก่าหลุด window แล้วเรียกได้อีก
+func TestMemoryStoreSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	rule := Rule{3, time.Minute}
+	t0 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		at          time.Duration
+		wantOK      bool
+		wantRetryAt time.Duration
+	}{
+		{0, true, 0},
+		{10 * time.Second, true, 0},
+		{20 * time.Second, true, 0},
+		{30 * time.Second, false, time.Minute},                  // ครบ 3 ครั้ง รอจน hit แรกหลุด window
+		{59 * time.Second, false, time.Minute},                  // hit ที่ถูกปฏิเสธไม่นับ
+		{61 * time.Second, true, 0},                             // hit แรกหลุดแล้ว
+		{62 * time.Second, false, 10*time.Second + time.Minute}, // เต็มอีกครั้ง รอ hit ที่ 10 วินาที
+	} {
+		ok, retryAt, err := store.Take(ctx, "k", rule, t0.Add(tc.at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tc.wantOK {
+			t.Fatalf("at +%v: ok = %v, want %v", tc.at, ok, tc.wantOK)
+		}
+		if !ok && !retryAt.Equal(t0.Add(tc.wantRetryAt)) {
+			t.Fatalf("at +%v: retryAt = +%v, want +%v", tc.at, retryAt.Sub(t0), tc.wantRetryAt)
+		}
+	}
+}
+
+// request พร้อมกันต้องผ่านได้ไม่เกิน Limit
+func TestLimiterAllowConcurrent(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{Store: NewMemoryStore(), Config: DefaultConfig()}
+	rule := Rule{10, time.Minute}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wait, err := l.Allow(ctx, "register:ip:1.2.3.4", rule); err == nil && wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != rule.Limit {
+		t.Fatalf("allowed = %d, want %d", allowed, rule.Limit)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.Lockout = Lockout{MaxFailures: 3, Window: time.Minute, Duration: 15 * time.Minute}
+	l := &Limiter{Store: NewMemoryStore(), Config: cfg}
+	key := "login:lock:user:1"
+
+	for i := 1; i < cfg.Lockout.MaxFailures; i++ {
+		if wait, err := l.RecordFailure(ctx, key); err != nil || wait != 0 {
+			t.Fatalf("failure %d: wait = %v, err = %v; want no lock", i, wait, err)
+		}
+	}
+	// login สำเร็จล้างตัวนับ ต้องผิดครบใหม่ถึงจะล็อก
+	if err := l.RecordSuccess(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < cfg.Lockout.MaxFailures; i++ {
+		if wait, _ := l.RecordFailure(ctx, key); wait != 0 {
+			t.Fatalf("failure %d after success locked the key", i)
+		}
+	}
+	if wait, _ := l.LockedFor(ctx, key); wait != 0 {
+		t.Fatalf("LockedFor = %v before reaching MaxFailures", wait)
+	}
+
+	wait, err := l.RecordFailure(ctx, key)
+	if err != nil || wait != cfg.Lockout.Duration {
+		t.Fatalf("last failure: wait = %v, err = %v; want %v", wait, err, cfg.Lockout.Duration)
+	}
+	if wait, _ := l.LockedFor(ctx, key); wait <= 0 || wait > cfg.Lockout.Duration {
+		t.Fatalf("LockedFor = %v, want up to %v", wait, cfg.Lockout.Duration)
+	}
+	if wait, _ := l.LockedFor(ctx, "login:lock:user:2"); wait != 0 {
+		t.Fatalf("other user locked for %v", wait)
+	}
+}
+
+func TestLimiterLockoutDisabled(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{Store: NewMemoryStore(), Config: Config{}}
+	for i := 0; i < 20; i++ {
+		if wait, err := l.RecordFailure(ctx, "k"); err != nil || wait != 0 {
+			t.Fatalf("RecordFailure with lockout disabled: wait = %v, err = %v", wait, err)
+		}
+	}
+	if wait, _ := l.LockedFor(ctx, "k"); wait != 0 {
+		t.Fatalf("LockedFor = %v, want 0", wait)
+	}
+}
@@ -3,22 +3,39 @@ package routes
 import (
 	"arttoy-hub/controllers"
 	"arttoy-hub/middleware"
+	"arttoy-hub/models"
 	"github.com/gin-gonic/gin"
 )
 
+// field ใน body ของ /Login ที่ใช้เป็นตัวระบุผู้ใช้สำหรับ rate limit และการล็อก
+var loginIDFields = []string{"identifier", "phonenumber", "gmail", "username"}
+
 func SetupAuthRoutes(r *gin.Engine) {
 	// Public user routes
-	r.POST("/Login", controllers.Login) // Login route
+	r.POST("/Login", middlewares.RateLimit("login", loginIDFields...), middlewares.LoginLockout(controllers.LoginUserID, loginIDFields...), controllers.Login) // Login route
+	r.POST("/Login/2fa", middlewares.RateLimit("login"), middlewares.LoginLockoutReset(), controllers.VerifyTwoFactorLogin) // ขั้นที่สองสำหรับผู้ที่เปิด 2FA
+	r.POST("/auth/refresh", middlewares.CSRFProtect("refresh_token"), controllers.RefreshToken) // ขอ access token ใหม่ด้วย refresh token
+	r.GET("/auth/csrf", middlewares.AuthMiddleware(), controllers.GetCSRFToken)                 // ขอ csrf token ใหม่
 	// r.POST("/Register", controllers.Register) // Register route
 	// Register ใหม่แบบ OTP
-	r.POST("/register/request-otp", controllers.RequestOTP) // ส่ง OTP ไปอีเมล
-	r.POST("/register/verify-otp", controllers.VerifyOTP)   // ยืนยัน OTP + สมัคร
+	register := r.Group("/register", middlewares.RateLimit("register", "gmail"))
+	{
+		register.POST("/request-otp", controllers.RequestOTP) // ส่ง OTP ไปอีเมล
+		register.POST("/verify-otp", controllers.VerifyOTP)   // ยืนยัน OTP + สมัคร
+		register.POST("/resend-otp", controllers.ResendOTP)   // ขอ OTP ใหม่ (มี cooldown)
+	}
+	password := r.Group("/password", middlewares.RateLimit("password", "gmail"))
+	{
+		password.POST("/forgot", controllers.ForgotPassword) // ส่ง token ตั้งรหัสผ่านใหม่ไปอีเมล
+		password.POST("/reset", controllers.ResetPassword)   // ตั้งรหัสผ่านใหม่ด้วย token
+	}
 	// r.GET("/search", controllers.SearchProducts)
 	// ใช้ AuthMiddleware กับ routes ที่ต้องการให้ login ก่อน
 	userRoutes := r.Group("/api/user")
 	userRoutes.Use(middlewares.AuthMiddleware()) // ต้อง login ก่อน
 	{
 		userRoutes.POST("/logout", controllers.Logout)
+		userRoutes.POST("/logout-all", controllers.LogoutAllDevices) // ออกจากระบบทุกอุปกรณ์
 		userRoutes.PUT("/Profile", controllers.UpdateProfile)
 		userRoutes.GET("/Profile", controllers.GetProfile)
 		userRoutes.GET("/favorites", controllers.GetUserFavorites)
@@ -31,22 +48,36 @@ func SetupAuthRoutes(r *gin.Engine) {
 		userRoutes.DELETE("/addresses/:address_id", controllers.DeleteAddress)
 		userRoutes.PUT("/addresses/:address_id", controllers.UpdateAddress)
 		// userRoutes.PUT("/update-address-field", controllers.UpdateUserWithAddressField) //เอาไว้อัพฟิลuser ที่ไม่มี
-		userRoutes.POST("/products", controllers.AddProduct)
-		userRoutes.POST("/become-seller", controllers.BecomeSeller)
+		userRoutes.POST("/products", middlewares.RequireRole(models.RoleSeller), controllers.AddProduct)
+		userRoutes.POST("/become-seller", middlewares.RequireFreshTOTP(), controllers.BecomeSeller) // ตั้งบัญชีธนาคาร
+
+		// 2FA (TOTP)
+		userRoutes.POST("/2fa/setup", controllers.SetupTwoFactor)
+		userRoutes.POST("/2fa/enable", controllers.EnableTwoFactor)
+		userRoutes.POST("/2fa/disable", middlewares.TOTPLockout(), controllers.DisableTwoFactor)
+		userRoutes.POST("/2fa/recovery-codes", middlewares.TOTPLockout(), controllers.RegenerateRecoveryCodes)
 
 	}
 }
 
 func SetupProductRoutes(r *gin.Engine) {
 
+	// อัปโหลดรูปสินค้าตรงไปที่ storage: ขอ URL -> PUT ไฟล์ -> finalize
+	uploads := r.Group("/api/uploads", middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleSeller))
+	{
+		uploads.POST("/sessions", controllers.CreateUploadSession)
+		uploads.POST("/sessions/:id/finalize", controllers.FinalizeUploadSession)
+	}
+
 	products := r.Group("/api/products")
 	{
 		products.GET("", controllers.GetAllProducts)
-		products.POST("",middlewares.AuthMiddleware(), controllers.AddProduct)
+		products.POST("", middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleSeller), controllers.AddProduct)
 		products.GET("/my-products", middlewares.AuthMiddleware(), controllers.GetMyProducts)
 		products.GET("/:id", controllers.GetProductByID)
-		products.PUT("/:id",middlewares.AuthMiddleware(), controllers.UpdateProduct)
-		products.DELETE("/:id", controllers.DeleteProduct)
+		products.PUT("/:id", middlewares.AuthMiddleware(), middlewares.ProductOwnerOrAdmin(), controllers.UpdateProduct)
+		products.PATCH("/:id", middlewares.AuthMiddleware(), middlewares.ProductOwnerOrAdmin(), controllers.UpdateProduct) // แก้เฉพาะ field ที่ส่งมา
+		products.DELETE("/:id", middlewares.AuthMiddleware(), middlewares.ProductOwnerOrAdmin(), controllers.DeleteProduct)
 		products.GET("/search", controllers.SearchProducts)
 	}
 
@@ -64,12 +95,15 @@ func SetupOrderRoutes(r *gin.Engine) {
 	{
 		order.GET("", controllers.GetUserOrders)            //  ดูคำสั่งซื้อทั้งหมดของผู้ใช้
 		order.GET("/:id", controllers.GetOrderByID)
+		order.GET("/:id/timeline", controllers.GetOrderTimeline)
 		order.POST("/:id/confirm", controllers.ConfirmOrderDelivery)
-		order.PUT("/:id/tracking", controllers.UpdateTrackingNumber)
-		order.PUT("/:id/accept", controllers.AcceptOrderBySeller)
-		order.PUT("/:id/reject", controllers.RejectOrderBySeller)
-		order.GET("/seller", controllers.GetSellerOrders)
+		order.PUT("/:id/tracking", middlewares.RequireRole(models.RoleSeller), controllers.UpdateTrackingNumber)
+		order.PUT("/:id/accept", middlewares.RequireRole(models.RoleSeller), controllers.AcceptOrderBySeller)
+		order.PUT("/:id/reject", middlewares.RequireRole(models.RoleSeller), controllers.RejectOrderBySeller)
+		order.POST("/:id/cancel", controllers.CancelOrderByBuyer)
+		order.GET("/seller", middlewares.RequireRole(models.RoleSeller), controllers.GetSellerOrders)
 		order.POST("/qr", controllers.CreatePromptPayCustomOrder)
+		order.GET("/checkouts/:id", controllers.GetCheckout) // การจ่ายเงินรวมและ order ย่อยต่อผู้ขาย
 		order.POST("/:id/mark-paid", controllers.MarkPromptPayOrderPaid)
 	}
 }
@@ -77,6 +111,7 @@ func PaymentRoutes(r *gin.Engine) {
 	payment := r.Group("/api/payment")
 	{
 		payment.POST("/charge", controllers.CreateTestCharge)
+		payment.POST("/webhook", controllers.OmiseWebhook) // Omise เรียกเข้ามาเอง ไม่ต้อง login
 	}
 }
 func CategoryRoutes(r *gin.Engine) {
@@ -102,5 +137,29 @@ func SetupSellerRoutes(r *gin.Engine) {
 
 		//ดึงข้อมูลโปรไฟล์ผู้ขาย
 		seller.GET("/:seller_id", controllers.GetSellerInfo)
+
+		// wallet ของผู้ขายที่ login อยู่
+		seller.GET("/me/wallet", middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleSeller), controllers.GetMyWallet)
+	}
+}
+func SetupAdminRoutes(r *gin.Engine) {
+	admin := r.Group("/api/admin", middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/refunds", controllers.GetPendingRefunds)          // order ที่ยังคืนเงินไม่สำเร็จ
+		admin.POST("/orders/:id/refund", controllers.RetryOrderRefund) // สั่งคืนเงินใหม่
+
+		admin.GET("/payouts", controllers.GetPayouts)                                    // รายการโอนเงินให้ผู้ขาย
+		admin.POST("/payouts/:id/retry", middlewares.RequireFreshTOTP(), controllers.RetryPayout) // สั่งโอน payout ที่ล้มเหลวใหม่
+		admin.GET("/payout-mismatches", controllers.GetPayoutMismatches)                 // ผลกระทบยอดที่ไม่ตรง
+		admin.POST("/payout-mismatches/:id/resolve", middlewares.RequireFreshTOTP(), controllers.ResolvePayoutMismatch) // ปิดรายการที่ตรวจแล้ว
+
+		admin.POST("/users/:id/roles", controllers.GrantUserRole)          // เพิ่มบทบาทให้ผู้ใช้
+		admin.DELETE("/users/:id/roles/:role", controllers.RevokeUserRole) // ถอนบทบาท
+
+		admin.GET("/sellers/:id/id-card", middlewares.RequireFreshTOTP(), controllers.GetSellerIDCardURL) // URL ชั่วคราวดูรูปบัตรประชาชน (บันทึกทุกครั้ง)
+		admin.GET("/sellers/:id/id-card/access-log", controllers.GetSellerKYCAccessLogs)                // ใครเปิดดูเมื่อไร
+
+		admin.GET("/storage/orphans", controllers.GetOrphanedImages)              // รายงานรูปที่ไม่มีใครใช้ (dry run)
+		admin.POST("/storage/orphans/sweep", controllers.SweepOrphanedImagesNow) // ลบรูปที่ไม่มีใครใช้ทันที
 	}
 }
@@ -11,8 +11,8 @@ func SetupRoutes(r *gin.Engine) {
 	r.Use(cors.New(cors.Config{
         AllowOrigins:     []string{"http://localhost:5173"}, // ตั้งค่า origin ที่จะอนุญาต
         // AllowOrigins:     []string{"http://localhost:5173"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}, // method ที่อนุญาต
-        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Cookie"}, // headers ที่อนุญาต
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}, // method ที่อนุญาต
+        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Cookie", "X-CSRF-Token", "X-TOTP-Code"}, // headers ที่อนุญาต
         AllowCredentials: true, // อนุญาตให้ใช้ cookies และ credentials
     }))
 	r.OPTIONS("/*path", func(c *gin.Context) {
@@ -28,5 +28,6 @@ func SetupRoutes(r *gin.Engine) {
 	CategoryRoutes(r)
 	SetupReviewRoutes(r)
 	SetupSellerRoutes(r)
+	SetupAdminRoutes(r)
 	
 }
\ No newline at end of file
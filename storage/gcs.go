@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore เก็บไฟล์ใน bucket ของ Google Cloud Storage (bucket ต้องเปิดอ่านสาธารณะสำหรับรูปที่แสดงบนเว็บ)
+type GCSStore struct {
+	client *gstorage.Client
+	bucket string
+}
+
+func NewGCSStore(client *gstorage.Client, bucket string) *GCSStore {
+	return &GCSStore{client: client, bucket: bucket}
+}
+
+func (s *GCSStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	writer := s.client.Bucket(s.bucket).Object(key).NewWriter(ctx)
+	writer.ContentType = contentType
+	if _, err := io.Copy(writer, r); err != nil {
+		writer.Close()
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return s.URL(key), nil
+}
+
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	err = s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if errors.Is(err, gstorage.ErrObjectNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *GCSStore) SignedURL(_ context.Context, key, method string, expires time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return s.client.Bucket(s.bucket).SignedURL(key, &gstorage.SignedURLOptions{
+		Scheme:  gstorage.SigningSchemeV4,
+		Method:  method,
+		Expires: time.Now().Add(expires),
+	})
+}
+
+// ใส่ x-goog-content-length-range ในลายเซ็น GCS จะปฏิเสธไฟล์ที่ใหญ่เกินตั้งแต่ตอนอัปโหลด
+func (s *GCSStore) SignedUploadURL(_ context.Context, key string, maxBytes int64, expires time.Duration) (string, map[string]string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	lengthRange := fmt.Sprintf("0,%d", maxBytes)
+	url, err := s.client.Bucket(s.bucket).SignedURL(key, &gstorage.SignedURLOptions{
+		Scheme:  gstorage.SigningSchemeV4,
+		Method:  http.MethodPut,
+		Expires: time.Now().Add(expires),
+		Headers: []string{"x-goog-content-length-range:" + lengthRange},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return url, map[string]string{"x-goog-content-length-range": lengthRange}, nil
+}
+
+func (s *GCSStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := s.client.Bucket(s.bucket).Object(key).NewReader(ctx)
+	if errors.Is(err, gstorage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	return reader, err
+}
+
+func (s *GCSStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	attrs, err := s.client.Bucket(s.bucket).Object(key).Attrs(ctx)
+	if errors.Is(err, gstorage.ErrObjectNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: attrs.Size, ContentType: attrs.ContentType, Updated: attrs.Updated}, nil
+}
+
+func (s *GCSStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	it := s.client.Bucket(s.bucket).Objects(ctx, &gstorage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		info := ObjectInfo{Key: attrs.Name, Size: attrs.Size, ContentType: attrs.ContentType, Updated: attrs.Updated}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *GCSStore) URL(key string) string {
+	return "https://storage.googleapis.com/" + s.bucket + "/" + key
+}
+
+func (s *GCSStore) KeyFromURL(url string) (string, bool) {
+	prefix := "https://storage.googleapis.com/" + s.bucket + "/"
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, prefix), true
+}
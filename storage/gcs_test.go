@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// key ที่ไม่ปลอดภัยต้องถูกปฏิเสธก่อนถึง GCS (client เป็น nil ถ้าหลุดไปจะ panic)
+func TestGCSStoreRejectsInvalidKeys(t *testing.T) {
+	store := NewGCSStore(nil, "bucket")
+	ctx := context.Background()
+	for _, key := range []string{"", "../secret", "a/../b", "a//b", `a\b`} {
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) accepted invalid key", key)
+		}
+		if _, err := store.Stat(ctx, key); err == nil {
+			t.Errorf("Stat(%q) accepted invalid key", key)
+		}
+		if _, err := store.Open(ctx, key); err == nil {
+			t.Errorf("Open(%q) accepted invalid key", key)
+		}
+		if _, err := store.SignedURL(ctx, key, "GET", time.Minute); err == nil {
+			t.Errorf("SignedURL(%q) accepted invalid key", key)
+		}
+		if _, _, err := store.SignedUploadURL(ctx, key, 1<<20, time.Minute); err == nil {
+			t.Errorf("SignedUploadURL(%q) accepted invalid key", key)
+		}
+	}
+}
+
+func TestNewFromEnvRequiresGCSBucket(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "gcs")
+	t.Setenv("GCS_BUCKET_NAME", "")
+	if _, err := NewFromEnv(context.Background()); err == nil {
+		t.Fatal("NewFromEnv accepted gcs without GCS_BUCKET_NAME")
+	}
+}
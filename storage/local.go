@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	localPublicPath  = "/uploads"
+	localSignedPath  = "/storage/signed"
+	localPrivatePath = "/storage/private"
+	maxLocalPutSize  = 20 << 20
+)
+
+// LocalStore เก็บไฟล์ในโฟลเดอร์บนดิสก์ Gin เสิร์ฟไฟล์ที่ /uploads และ URL แบบ signed ที่ /storage/signed
+// ถ้าเป็น private จะไม่เสิร์ฟไฟล์ตรง ๆ เปิดได้ผ่าน URL แบบ signed ที่ /storage/private เท่านั้น
+type LocalStore struct {
+	dir        string
+	baseURL    string
+	secret     []byte
+	private    bool
+	signedPath string
+}
+
+// secret ใช้เซ็น URL ชั่วคราว ถ้าว่างจะสุ่มใหม่ทุกครั้งที่เริ่ม server (URL เดิมจะใช้ไม่ได้หลัง restart)
+func NewLocalStore(dir, baseURL, secret string) (*LocalStore, error) {
+	return newLocalStore(dir, baseURL, secret, false)
+}
+
+// NewPrivateLocalStore store สำหรับเอกสารส่วนตัว (เช่นบัตรประชาชน) ไม่มี URL สาธารณะ
+func NewPrivateLocalStore(dir, baseURL, secret string) (*LocalStore, error) {
+	return newLocalStore(dir, baseURL, secret, true)
+}
+
+func newLocalStore(dir, baseURL, secret string, private bool) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	store := &LocalStore{dir: dir, baseURL: strings.TrimRight(baseURL, "/"), secret: key, private: private, signedPath: localSignedPath}
+	if private {
+		store.signedPath = localPrivatePath
+	}
+	return store, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(_ context.Context, key string, r io.Reader, _ string) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	// เขียนลงไฟล์ชั่วคราวก่อนแล้วค่อย rename จะได้ไม่มีไฟล์ครึ่ง ๆ
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return s.URL(key), nil
+}
+
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *LocalStore) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(path)),
+		Updated:     info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// ข้ามไฟล์ชั่วคราวที่กำลังเขียนอยู่
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(ObjectInfo{
+			Key:         key,
+			Size:        info.Size(),
+			ContentType: mime.TypeByExtension(filepath.Ext(path)),
+			Updated:     info.ModTime(),
+		})
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// store แบบ private คืน URL ที่ยังไม่ได้เซ็น เปิดตรง ๆ ไม่ได้
+func (s *LocalStore) URL(key string) string {
+	return s.urlPrefix() + key
+}
+
+func (s *LocalStore) urlPrefix() string {
+	if s.private {
+		return s.baseURL + s.signedPath + "/"
+	}
+	return s.baseURL + localPublicPath + "/"
+}
+
+func (s *LocalStore) KeyFromURL(u string) (string, bool) {
+	prefix := s.urlPrefix()
+	if !strings.HasPrefix(u, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(u, prefix), true
+}
+
+// maxBytes เป็น 0 สำหรับ URL ที่ไม่จำกัดขนาดเพิ่มจาก maxLocalPutSize
+func (s *LocalStore) sign(method, key string, expires, maxBytes int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	// ใส่ path ของ store ด้วย ลายเซ็นของ store สาธารณะจะเอาไปใช้กับ store private ไม่ได้
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%d", s.signedPath, method, key, expires, maxBytes)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStore) SignedURL(_ context.Context, key, method string, expires time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	exp := time.Now().Add(expires).Unix()
+	query := url.Values{}
+	query.Set("method", method)
+	query.Set("expires", strconv.FormatInt(exp, 10))
+	query.Set("signature", s.sign(method, key, exp, 0))
+	return s.baseURL + s.signedPath + "/" + key + "?" + query.Encode(), nil
+}
+
+// ขนาดสูงสุดอยู่ใน query และลายเซ็น client จึงไม่ต้องส่ง header เพิ่ม
+func (s *LocalStore) SignedUploadURL(_ context.Context, key string, maxBytes int64, expires time.Duration) (string, map[string]string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	exp := time.Now().Add(expires).Unix()
+	query := url.Values{}
+	query.Set("method", http.MethodPut)
+	query.Set("expires", strconv.FormatInt(exp, 10))
+	query.Set("max_bytes", strconv.FormatInt(maxBytes, 10))
+	query.Set("signature", s.sign(http.MethodPut, key, exp, maxBytes))
+	return s.baseURL + s.signedPath + "/" + key + "?" + query.Encode(), map[string]string{}, nil
+}
+
+// RegisterRoutes ให้ Gin เสิร์ฟไฟล์สาธารณะ (ยกเว้น store private) และรับ URL แบบ signed (GET อ่าน, PUT อัปโหลด)
+func (s *LocalStore) RegisterRoutes(r *gin.Engine) {
+	if !s.private {
+		r.Static(localPublicPath, s.dir)
+	}
+	r.GET(s.signedPath+"/*key", s.serveSigned)
+	r.PUT(s.signedPath+"/*key", s.serveSigned)
+}
+
+func (s *LocalStore) serveSigned(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	exp, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > exp || c.Query("method") != c.Request.Method {
+		c.JSON(http.StatusForbidden, gin.H{"error": "URL expired or invalid"})
+		return
+	}
+	var maxBytes int64
+	if v := c.Query("max_bytes"); v != "" {
+		if maxBytes, err = strconv.ParseInt(v, 10, 64); err != nil || maxBytes <= 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "URL expired or invalid"})
+			return
+		}
+	}
+	expected := s.sign(c.Request.Method, key, exp, maxBytes)
+	if !hmac.Equal([]byte(expected), []byte(c.Query("signature"))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+		return
+	}
+	path, err := s.path(key)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	if c.Request.Method == http.MethodPut {
+		limit := int64(maxLocalPutSize)
+		if maxBytes > 0 && maxBytes < limit {
+			limit = maxBytes
+		}
+		if c.Request.ContentLength > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File too large"})
+			return
+		}
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		if _, err := s.Put(c.Request.Context(), key, body, c.ContentType()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Upload failed"})
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	c.File(path)
+}
@@ -0,0 +1,145 @@
+// Package storage เก็บไฟล์ (รูปภาพ ฯลฯ) ผ่าน ObjectStore เลือกได้ระหว่าง Google Cloud Storage
+// หรือดิสก์ในเครื่องซึ่ง Gin เสิร์ฟเอง ใช้รันและทดสอบได้โดยไม่ต้องมีบัญชี cloud
+package storage
+
+import (
+	"arttoy-hub/gcs"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	Updated     time.Time
+}
+
+type ObjectStore interface {
+	// Put เขียน object แล้วคืน URL สาธารณะ
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error)
+	Delete(ctx context.Context, key string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// SignedURL URL ชั่วคราวสำหรับ method (GET หรือ PUT) หมดอายุตาม expires
+	SignedURL(ctx context.Context, key, method string, expires time.Duration) (string, error)
+	// SignedUploadURL URL ชั่วคราวสำหรับ PUT ที่รับไฟล์ได้ไม่เกิน maxBytes
+	// คืน header ที่ client ต้องส่งมากับ PUT ด้วย (ไม่ส่งหรือแก้ค่า ลายเซ็นจะไม่ผ่าน)
+	SignedUploadURL(ctx context.Context, key string, maxBytes int64, expires time.Duration) (string, map[string]string, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List เรียก fn กับทุก object ที่ key ขึ้นต้นด้วย prefix
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// URL สาธารณะของ key และแปลงกลับจาก URL เป็น key (false = ไม่ใช่ไฟล์ของ store นี้)
+	URL(key string) string
+	KeyFromURL(url string) (string, bool)
+}
+
+// CleanKey กัน path แปลก ๆ เช่น "../" หรือ "/" นำหน้า
+func CleanKey(key string) (string, error) {
+	key = strings.TrimLeft(key, "/")
+	if key == "" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid object key %q", key)
+		}
+	}
+	return key, nil
+}
+
+func driverFromEnv() string {
+	if driver := os.Getenv("STORAGE_DRIVER"); driver != "" {
+		return driver
+	}
+	if os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") != "" || os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON") != "" {
+		return "gcs"
+	}
+	return "local"
+}
+
+// เชื่อมต่อ GCS ครั้งเดียว ใช้ร่วมกันทั้ง store สาธารณะและ private
+func initGCS() error {
+	if gcs.Client != nil {
+		return nil
+	}
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return gcs.InitGCSFromFile(path)
+	}
+	return gcs.InitGCS(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON"))
+}
+
+func localBaseURL() string {
+	if baseURL := os.Getenv("LOCAL_STORAGE_BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+	return "http://localhost:8080"
+}
+
+// NewFromEnv เลือก store จาก STORAGE_DRIVER (gcs หรือ local)
+// ถ้าไม่ตั้งไว้ จะใช้ gcs เมื่อมี credential ของ Google มิฉะนั้นใช้ local
+func NewFromEnv(ctx context.Context) (ObjectStore, error) {
+	switch driver := driverFromEnv(); driver {
+	case "gcs":
+		bucket := os.Getenv("GCS_BUCKET_NAME")
+		if bucket == "" {
+			return nil, fmt.Errorf("GCS_BUCKET_NAME is required when STORAGE_DRIVER is gcs")
+		}
+		if err := initGCS(); err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using GCS bucket %s for storage\n", bucket)
+		return NewGCSStore(gcs.Client, bucket), nil
+
+	case "local":
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		store, err := NewLocalStore(dir, localBaseURL(), os.Getenv("STORAGE_SIGNING_SECRET"))
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using local storage at %s\n", dir)
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q (gcs or local)", driver)
+	}
+}
+
+// NewPrivateFromEnv store สำหรับเอกสารส่วนตัว เปิดดูได้ผ่าน SignedURL เท่านั้น
+// gcs ต้องตั้ง GCS_PRIVATE_BUCKET_NAME เป็น bucket ที่ไม่เปิดอ่านสาธารณะ
+func NewPrivateFromEnv(ctx context.Context) (ObjectStore, error) {
+	switch driver := driverFromEnv(); driver {
+	case "gcs":
+		bucket := os.Getenv("GCS_PRIVATE_BUCKET_NAME")
+		if bucket == "" {
+			return nil, fmt.Errorf("GCS_PRIVATE_BUCKET_NAME is required for private documents")
+		}
+		if bucket == os.Getenv("GCS_BUCKET_NAME") {
+			return nil, fmt.Errorf("GCS_PRIVATE_BUCKET_NAME must differ from the public GCS_BUCKET_NAME")
+		}
+		if err := initGCS(); err != nil {
+			return nil, err
+		}
+		return NewGCSStore(gcs.Client, bucket), nil
+
+	case "local":
+		dir := os.Getenv("LOCAL_PRIVATE_STORAGE_DIR")
+		if dir == "" {
+			dir = "./private_uploads"
+		}
+		return NewPrivateLocalStore(dir, localBaseURL(), os.Getenv("STORAGE_SIGNING_SECRET"))
+
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q (gcs or local)", driver)
+	}
+}
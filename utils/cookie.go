@@ -0,0 +1,101 @@
+package utils
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ตั้งค่า cookie ของระบบจาก env โหลดครั้งเดียวตอนเริ่ม server ด้วย LoadCookieConfig
+type CookieConfig struct {
+    Domain   string
+    Secure   bool
+    SameSite http.SameSite
+    HttpOnly bool
+}
+
+var cookieConfig = CookieConfig{SameSite: http.SameSiteLaxMode, HttpOnly: true}
+
+const (
+    CSRFCookieName = "csrf_token"
+    CSRFHeaderName = "X-CSRF-Token"
+)
+
+// LoadCookieConfig อ่าน COOKIE_DOMAIN, COOKIE_SECURE, COOKIE_SAMESITE (lax|strict|none) และ COOKIE_HTTPONLY
+func LoadCookieConfig() error {
+    cfg := CookieConfig{
+        Domain:   os.Getenv("COOKIE_DOMAIN"),
+        Secure:   os.Getenv("COOKIE_SECURE") == "true",
+        SameSite: http.SameSiteLaxMode,
+        HttpOnly: os.Getenv("COOKIE_HTTPONLY") != "false",
+    }
+    switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+    case "", "lax":
+    case "strict":
+        cfg.SameSite = http.SameSiteStrictMode
+    case "none":
+        cfg.SameSite = http.SameSiteNoneMode
+    default:
+        return fmt.Errorf("COOKIE_SAMESITE must be lax, strict or none")
+    }
+    // browser ไม่รับ SameSite=None ถ้าไม่ใช่ Secure
+    if cfg.SameSite == http.SameSiteNoneMode && !cfg.Secure {
+        return fmt.Errorf("COOKIE_SAMESITE=none requires COOKIE_SECURE=true")
+    }
+    cookieConfig = cfg
+    return nil
+}
+
+func setCookie(c *gin.Context, name, value string, maxAge int, path string, httpOnly bool) {
+    http.SetCookie(c.Writer, &http.Cookie{
+        Name:     name,
+        Value:    value,
+        MaxAge:   maxAge,
+        Path:     path,
+        Domain:   cookieConfig.Domain,
+        Secure:   cookieConfig.Secure,
+        HttpOnly: httpOnly,
+        SameSite: cookieConfig.SameSite,
+    })
+}
+
+// SetAuthCookie ตั้ง cookie ของ access token ตามค่าที่โหลดจาก env (HttpOnly ปิดได้ถ้า frontend ต้องอ่านเอง)
+func SetAuthCookie(c *gin.Context, name, value string, maxAge int, path string) {
+    setCookie(c, name, value, maxAge, path, cookieConfig.HttpOnly)
+}
+
+// SetSecretCookie เหมือน SetAuthCookie แต่ HttpOnly เสมอ ใช้กับ refresh token
+func SetSecretCookie(c *gin.Context, name, value string, maxAge int, path string) {
+    setCookie(c, name, value, maxAge, path, true)
+}
+
+func ClearCookie(c *gin.Context, name, path string) {
+    setCookie(c, name, "", -1, path, true)
+}
+
+// IssueCSRFCookie ออก csrf token ใหม่ (double-submit) JavaScript ต้องอ่านได้ จึงไม่ตั้ง HttpOnly
+func IssueCSRFCookie(c *gin.Context, maxAge int) (string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", err
+    }
+    token := base64.RawURLEncoding.EncodeToString(raw)
+    setCookie(c, CSRFCookieName, token, maxAge, "/", false)
+    return token, nil
+}
+
+// ValidCSRF ค่าใน header X-CSRF-Token ต้องตรงกับ cookie csrf_token
+func ValidCSRF(c *gin.Context) bool {
+    cookie, err := c.Cookie(CSRFCookieName)
+    header := c.GetHeader(CSRFHeaderName)
+    if err != nil || cookie == "" || header == "" {
+        return false
+    }
+    return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
@@ -6,13 +6,24 @@ import (
     "os"
 )
 
-func SendEmail(toEmail, otp string) error {
+// ส่งอีเมลผ่าน Gmail SMTP ด้วยบัญชีจาก EMAIL_FROM / EMAIL_PASS
+func SendMail(toEmail, subject, body string) error {
     from := os.Getenv("EMAIL_FROM")
     pass := os.Getenv("EMAIL_PASS")
 
-    msg := fmt.Sprintf(`Subject: ArtToyHub - OTP Verification
+    msg := fmt.Sprintf("Subject: %s\n\n%s", subject, body)
+
+    return smtp.SendMail(
+        "smtp.gmail.com:587",
+        smtp.PlainAuth("", from, pass, "smtp.gmail.com"),
+        from,
+        []string{toEmail},
+        []byte(msg),
+    )
+}
 
-Dear user,
+func SendEmail(toEmail, otp string) error {
+    return SendMail(toEmail, "ArtToyHub - OTP Verification", fmt.Sprintf(`Dear user,
 
 Your One-Time Password (OTP) for verifying your email is:
 
@@ -22,13 +33,26 @@ Please enter this code to complete your registration.
 
 Thank you,
 ArtToyHub Team
-`, otp)
+`, otp))
+}
 
-    return smtp.SendMail(
-        "smtp.gmail.com:587",
-        smtp.PlainAuth("", from, pass, "smtp.gmail.com"),
-        from,
-        []string{toEmail},
-        []byte(msg),
-    )
+// ส่งลิงก์/รหัสสำหรับตั้งรหัสผ่านใหม่ (link ว่างได้ถ้าไม่ได้ตั้ง FRONTEND_URL)
+func SendPasswordResetEmail(toEmail, token, link string, validMinutes int) error {
+    body := fmt.Sprintf(`Dear user,
+
+We received a request to reset your ArtToyHub password.
+
+🔐 Reset code: %s
+`, token)
+    if link != "" {
+        body += fmt.Sprintf("\nOr open this link: %s\n", link)
+    }
+    body += fmt.Sprintf(`
+This code can be used once and expires in %d minutes.
+If you did not request a password reset, you can ignore this email.
+
+Thank you,
+ArtToyHub Team
+`, validMinutes)
+    return SendMail(toEmail, "ArtToyHub - Reset your password", body)
 }
@@ -0,0 +1,16 @@
+package utils
+
+import (
+    "crypto/rand"
+    "fmt"
+    "math/big"
+)
+
+// สุ่ม OTP ตัวเลข 6 หลักด้วย crypto/rand
+func GenerateOTP() (string, error) {
+    n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+    if err != nil {
+        return "", err
+    }
+    return fmt.Sprintf("%06d", n.Int64()), nil
+}
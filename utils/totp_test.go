@@ -0,0 +1,152 @@
+package utils
+
+import (
+    "encoding/base32"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+)
+
+// secret ของ test vector ใน RFC 6238 ภาคผนวก B ("12345678901234567890")
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestMatchTOTPRFC6238Vectors(t *testing.T) {
+    for _, tc := range []struct {
+        unix int64
+        code string // 6 หลักท้ายของค่าใน RFC
+    }{
+        {59, "287082"},
+        {1111111109, "081804"},
+        {1111111111, "050471"},
+        {1234567890, "005924"},
+        {2000000000, "279037"},
+        {20000000000, "353130"},
+    } {
+        step, ok := MatchTOTP(rfcSecret, tc.code, time.Unix(tc.unix, 0))
+        if !ok || step != tc.unix/totpPeriod {
+            t.Errorf("MatchTOTP(%s at %d) = %d, %v; want step %d", tc.code, tc.unix, step, ok, tc.unix/totpPeriod)
+        }
+    }
+}
+
+// ยอมรับช่วงก่อน/หลังได้ 1 ช่วง เกินกว่านั้นไม่รับ
+func TestMatchTOTPDrift(t *testing.T) {
+    key, _ := totpEncoding.DecodeString(rfcSecret)
+    now := time.Unix(1234567890, 0)
+    current := now.Unix() / totpPeriod
+
+    for _, tc := range []struct {
+        name   string
+        offset int64
+        want   bool
+    }{
+        {"current step", 0, true},
+        {"previous step", -1, true},
+        {"next step", 1, true},
+        {"two steps behind", -2, false},
+        {"two steps ahead", 2, false},
+        {"ten minutes old", -20, false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            step, ok := MatchTOTP(rfcSecret, totpCode(key, current+tc.offset), now)
+            if ok != tc.want {
+                t.Fatalf("ok = %v, want %v", ok, tc.want)
+            }
+            if ok && step != current+tc.offset {
+                t.Fatalf("step = %d, want %d", step, current+tc.offset)
+            }
+        })
+    }
+}
+
+// รหัสเดิมที่ส่งซ้ำในช่วงถัดไปต้องได้ step เดิม ผู้เรียกจึงเทียบกับ last_used_step แล้วปฏิเสธได้
+func TestMatchTOTPReplayReturnsSameStep(t *testing.T) {
+    now := time.Unix(1111111111, 0)
+    first, ok := MatchTOTP(rfcSecret, "050471", now)
+    if !ok {
+        t.Fatal("code rejected on first use")
+    }
+    again, ok := MatchTOTP(rfcSecret, "050471", now.Add(totpPeriod*time.Second))
+    if !ok || again != first {
+        t.Fatalf("replay = %d, %v; want step %d so it can be rejected as used", again, ok, first)
+    }
+}
+
+func TestMatchTOTPInput(t *testing.T) {
+    now := time.Unix(1111111111, 0)
+    for _, tc := range []struct {
+        name, secret, code string
+        want               bool
+    }{
+        {"spaces in code", rfcSecret, " 050 471 ", true},
+        {"lowercase secret", strings.ToLower(rfcSecret), "050471", true},
+        {"wrong code", rfcSecret, "050472", false},
+        {"too short", rfcSecret, "50471", false},
+        {"too long", rfcSecret, "0504710", false},
+        {"empty", rfcSecret, "", false},
+        {"invalid secret", "not base32!", "050471", false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            if _, ok := MatchTOTP(tc.secret, tc.code, now); ok != tc.want {
+                t.Fatalf("ok = %v, want %v", ok, tc.want)
+            }
+        })
+    }
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+    secret, err := GenerateTOTPSecret()
+    if err != nil {
+        t.Fatal(err)
+    }
+    raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+    if err != nil || len(raw) != 20 {
+        t.Fatalf("secret %q decodes to %d bytes, %v; want 20", secret, len(raw), err)
+    }
+    other, _ := GenerateTOTPSecret()
+    if other == secret {
+        t.Fatal("two secrets are identical")
+    }
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+    u, err := url.Parse(TOTPProvisioningURI(rfcSecret, "ArtToy Hub", "seller@example.com"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/ArtToy Hub:seller@example.com" {
+        t.Fatalf("uri = %s", u)
+    }
+    q := u.Query()
+    if q.Get("secret") != rfcSecret || q.Get("issuer") != "ArtToy Hub" || q.Get("digits") != "6" || q.Get("period") != "30" {
+        t.Fatalf("query = %v", q)
+    }
+}
+
+func TestRecoveryCodes(t *testing.T) {
+    codes, err := GenerateRecoveryCodes(10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    seen := map[string]bool{}
+    for _, code := range codes {
+        if len(code) != 11 || code[5] != '-' || seen[code] {
+            t.Fatalf("bad or duplicate recovery code %q", code)
+        }
+        seen[code] = true
+        if NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", " "))) != code {
+            t.Fatalf("NormalizeRecoveryCode does not round-trip %q", code)
+        }
+    }
+    for in, want := range map[string]string{
+        "abcde-fghij":   "abcde-fghij",
+        "ABCDEFGHIJ":    "abcde-fghij",
+        " abcde fghij ": "abcde-fghij",
+        "abc":           "abc",
+    } {
+        if got := NormalizeRecoveryCode(in); got != want {
+            t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", in, got, want)
+        }
+    }
+}